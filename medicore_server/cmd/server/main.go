@@ -1,13 +1,19 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"medicore/internal/api"
 	"medicore/internal/database"
+	"medicore/internal/middleware"
+	"medicore/internal/repository"
+	"medicore/internal/services"
 )
 
 const (
@@ -33,6 +39,11 @@ func main() {
 	}
 	defer db.Close()
 
+	// Bring existing databases up to the current schema
+	if err := database.Migrate(db); err != nil {
+		log.Fatalf("❌ Failed to run migrations: %v", err)
+	}
+
 	// Get local IP for display
 	localIP := getLocalIP()
 
@@ -54,12 +65,131 @@ func main() {
 		}
 	}()
 
+	// Session authentication for every /api route
+	authMiddleware := middleware.NewAuthMiddleware(db)
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := authMiddleware.CleanupExpiredSessions(); err != nil {
+				log.Printf("⚠️ Session cleanup failed: %v", err)
+			}
+		}
+	}()
+
+	// Deleted patients stay restorable for PATIENT_RETENTION_DAYS, then are purged
+	retention := getEnvInt("PATIENT_RETENTION_DAYS", services.DefaultPatientRetentionDays)
+	go services.NewPatientPurgeService(db, retention).SchedulePurge(24 * time.Hour)
+
+	// Delta sync clients that have not synced for SyncDeletionRetention get a
+	// full sync, so older deletion records can go
+	go func() {
+		ticker := time.NewTicker(24 * time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			err := repository.InTx(db, func(tx repository.DBTX) error {
+				_, err := repository.NewSyncRepository(tx).PruneDeletions(time.Now().Add(-repository.SyncDeletionRetention))
+				return err
+			})
+			if err != nil {
+				log.Printf("⚠️ Sync deletions cleanup failed: %v", err)
+			}
+		}
+	}()
+
 	// Setup REST API server
-	restHandler := api.NewRESTHandler(db)
+	restHandler := api.NewRESTHandler(db, authMiddleware)
+	restHandler.Start(context.Background())
+	defer restHandler.Stop()
+
+	// Back up the database every BACKUP_INTERVAL_HOURS (0 for manual backups
+	// only) into BACKUP_DIR, keeping BACKUP_RETENTION_DAYS of backups.
+	// Backups are encrypted with BACKUP_KEY (64 hex characters) or
+	// BACKUP_PASSPHRASE.
+	backupDir := os.Getenv("BACKUP_DIR")
+	if backupDir == "" {
+		backupDir = services.DefaultBackupDir
+	}
+	backupInterval := getEnvInt("BACKUP_INTERVAL_HOURS", services.DefaultBackupIntervalHours)
+	backupRetention := getEnvInt("BACKUP_RETENTION_DAYS", services.DefaultBackupRetentionDays)
+	backups, err := services.NewBackupService(db, backupDir, dbConfig.Host, dbConfig.Port, dbConfig.User, dbConfig.Password, dbConfig.DBName, backupRetention)
+	if err != nil {
+		log.Printf("⚠️ Backups disabled: %v", err)
+	} else {
+		if value := os.Getenv("BACKUP_KEY"); value != "" {
+			key, err := services.ParseBackupKey(value)
+			if err != nil {
+				log.Fatalf("❌ Invalid BACKUP_KEY: %v", err)
+			}
+			backups.SetEncryptionSecret(key)
+		} else if passphrase := os.Getenv("BACKUP_PASSPHRASE"); passphrase != "" {
+			backups.SetEncryptionSecret([]byte(passphrase))
+		} else {
+			log.Println("⚠️ Backups are NOT encrypted: set BACKUP_KEY or BACKUP_PASSPHRASE")
+		}
+		// Copy every backup off-site to the destinations of BACKUP_DESTINATIONS_FILE
+		if path := os.Getenv("BACKUP_DESTINATIONS_FILE"); path != "" {
+			destinations, err := services.LoadDestinationConfigs(path)
+			if err != nil {
+				log.Fatalf("❌ %v", err)
+			}
+			for _, destination := range destinations {
+				if err := backups.AddDestination(destination); err != nil {
+					log.Fatalf("❌ %v", err)
+				}
+			}
+		} else {
+			log.Println("⚠️ Backups are only kept on this machine: set BACKUP_DESTINATIONS_FILE")
+		}
+		restHandler.SetBackups(backups)
+
+		otherDB := func(dbName string) string {
+			other := dbConfig
+			other.DBName = dbName
+			return other.ConnString()
+		}
+
+		// Restores go through a new database, migrated then switched in
+		backups.EnableStagedRestore(services.RestoreConfig{
+			ConnString:   otherDB,
+			MaxIdleConns: dbConfig.MaxIdleConns,
+			Prepare:      database.Migrate,
+		})
+
+		// Test-restore every new backup into a scratch database
+		if os.Getenv("BACKUP_VERIFY") != "false" {
+			verifier := services.NewBackupVerifier(backups, db, otherDB)
+			restHandler.SetBackupVerifier(verifier)
+			backups.OnCreated(verifier.Enqueue)
+			go verifier.Run()
+		}
+		if backupInterval > 0 {
+			go backups.ScheduleBackup(time.Duration(backupInterval) * time.Hour)
+		} else {
+			log.Println("ℹ️ Scheduled backups disabled: BACKUP_INTERVAL_HOURS is 0")
+		}
+	}
+
+	// Share real-time events with the other server instances on this database
+	relay, err := api.StartEventRelay(restHandler.Events(), db, dbConfig.ConnString())
+	if err != nil {
+		log.Printf("⚠️ Event relay disabled, real-time events stay on this instance: %v", err)
+	} else {
+		defer relay.Close()
+	}
+
 	mux := http.NewServeMux()
+	restHandler.SetupAuthRoutes(mux) // Login, logout, refresh, health
 	restHandler.SetupRoutes(mux)
 	restHandler.SetupSSERoutes(mux) // Real-time events via Server-Sent Events
 
+	handler := middleware.ChainMiddleware(mux,
+		middleware.RecoveryMiddleware,
+		middleware.CORSMiddleware,
+		restHandler.MaintenanceMiddleware, // Before auth: sessions cannot be checked during a restore
+		authMiddleware.Middleware,
+	)
+
 	log.Println("")
 	log.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 	log.Println("✅ MEDICORE SERVER READY FOR LAN CONNECTIONS")
@@ -70,13 +200,28 @@ func main() {
 	log.Printf("💻 Computer:    %s", getHostname())
 	log.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 	log.Println("📡 Real-time sync enabled via Server-Sent Events")
+	log.Println("🔐 Authentication required: POST /api/auth/login for a session token")
 	log.Println("")
 
-	if err := http.ListenAndServe(restAddr, mux); err != nil {
+	if err := http.ListenAndServe(restAddr, handler); err != nil {
 		log.Fatalf("❌ Failed to start REST server: %v", err)
 	}
 }
 
+// getEnvInt reads an integer environment variable, or returns fallback
+// when it is not set
+func getEnvInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("❌ Invalid %s %q: %v", name, value, err)
+	}
+	return number
+}
+
 // getLocalIP returns the local IP address for LAN
 func getLocalIP() string {
 	addrs, err := net.InterfaceAddrs()
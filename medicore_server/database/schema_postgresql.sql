@@ -95,9 +95,14 @@ CREATE TABLE IF NOT EXISTS patients (
     -- Metadata
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-    needs_sync BOOLEAN DEFAULT TRUE
+    needs_sync BOOLEAN DEFAULT TRUE,
+    sync_txid BIGINT NOT NULL DEFAULT 0,  -- Transaction of the last write, for delta sync
+    deleted_at TIMESTAMP WITH TIME ZONE,  -- Soft delete, purged after PATIENT_RETENTION_DAYS
+
+    CONSTRAINT patients_barcode_not_empty CHECK (barcode <> '')
 );
 
+CREATE INDEX IF NOT EXISTS idx_patients_deleted ON patients(deleted_at) WHERE deleted_at IS NOT NULL;
 CREATE INDEX IF NOT EXISTS idx_patients_barcode ON patients(barcode);
 CREATE INDEX IF NOT EXISTS idx_patients_name ON patients(last_name, first_name);
 CREATE INDEX IF NOT EXISTS idx_patients_phone ON patients(phone_number);
@@ -170,7 +175,9 @@ CREATE TABLE IF NOT EXISTS visits (
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     needs_sync BOOLEAN DEFAULT TRUE,
-    is_active BOOLEAN DEFAULT TRUE
+    is_active BOOLEAN DEFAULT TRUE,
+    sync_txid BIGINT NOT NULL DEFAULT 0,  -- Transaction of the last write, for delta sync
+    deleted_at TIMESTAMP WITH TIME ZONE  -- Soft delete, set with the patient
 );
 
 CREATE INDEX IF NOT EXISTS idx_visits_patient ON visits(patient_code, visit_date DESC);
@@ -215,7 +222,9 @@ CREATE TABLE IF NOT EXISTS ordonnances (
     
     -- Metadata
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    sync_txid BIGINT NOT NULL DEFAULT 0,  -- Transaction of the last write, for delta sync
+    deleted_at TIMESTAMP WITH TIME ZONE  -- Soft delete, set with the patient
 );
 
 CREATE INDEX IF NOT EXISTS idx_ordonnances_patient ON ordonnances(patient_code, document_date DESC);
@@ -252,6 +261,7 @@ CREATE TABLE IF NOT EXISTS medical_acts (
     name VARCHAR(255) NOT NULL,
     fee_amount INTEGER NOT NULL,
     display_order INTEGER,
+    is_active BOOLEAN DEFAULT TRUE,
     
     -- Metadata
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
@@ -281,7 +291,9 @@ CREATE TABLE IF NOT EXISTS payments (
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     needs_sync BOOLEAN DEFAULT TRUE,
-    is_active BOOLEAN DEFAULT TRUE
+    is_active BOOLEAN DEFAULT TRUE,
+    sync_txid BIGINT NOT NULL DEFAULT 0,  -- Transaction of the last write, for delta sync
+    deleted_at TIMESTAMP WITH TIME ZONE  -- Soft delete, set with the patient
 );
 
 CREATE INDEX IF NOT EXISTS idx_payments_user ON payments(user_id, payment_time DESC);
@@ -319,7 +331,8 @@ CREATE TABLE IF NOT EXISTS messages (
     sent_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     read_at TIMESTAMP WITH TIME ZONE,
     patient_code INTEGER,
-    patient_name VARCHAR(255)
+    patient_name VARCHAR(255),
+    deleted_at TIMESTAMP WITH TIME ZONE  -- Soft delete, set with the patient
 );
 
 CREATE INDEX IF NOT EXISTS idx_messages_room ON messages(room_id, sent_at DESC);
@@ -349,7 +362,8 @@ CREATE TABLE IF NOT EXISTS waiting_patients (
     sent_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     is_checked BOOLEAN DEFAULT FALSE,
     is_active BOOLEAN DEFAULT TRUE,
-    is_notified BOOLEAN DEFAULT FALSE
+    is_notified BOOLEAN DEFAULT FALSE,
+    deleted_at TIMESTAMP WITH TIME ZONE  -- Soft delete, set with the patient
 );
 
 CREATE INDEX IF NOT EXISTS idx_waiting_room ON waiting_patients(room_id, sent_at) WHERE is_active = TRUE;
@@ -374,7 +388,9 @@ CREATE TABLE IF NOT EXISTS appointments (
     existing_patient_code INTEGER REFERENCES patients(code),
     was_added BOOLEAN DEFAULT FALSE,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-    created_by VARCHAR(255)
+    created_by VARCHAR(255),
+    sync_txid BIGINT NOT NULL DEFAULT 0,  -- Transaction of the last write, for delta sync
+    deleted_at TIMESTAMP WITH TIME ZONE  -- Soft delete, set with the patient
 );
 
 CREATE INDEX IF NOT EXISTS idx_appointments_date ON appointments(appointment_date);
@@ -406,7 +422,9 @@ CREATE TABLE IF NOT EXISTS surgery_plans (
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     created_by VARCHAR(255),
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-    needs_sync BOOLEAN DEFAULT TRUE
+    needs_sync BOOLEAN DEFAULT TRUE,
+    sync_txid BIGINT NOT NULL DEFAULT 0,  -- Transaction of the last write, for delta sync
+    deleted_at TIMESTAMP WITH TIME ZONE  -- Soft delete, set with the patient
 );
 
 CREATE INDEX IF NOT EXISTS idx_surgery_date ON surgery_plans(surgery_date);
@@ -463,6 +481,15 @@ CREATE TABLE IF NOT EXISTS nurse_preferences (
 
 CREATE INDEX IF NOT EXISTS idx_nurse_active ON nurse_preferences(is_active) WHERE is_active = TRUE;
 
+-- Compte-rendu templates
+CREATE TABLE IF NOT EXISTS templates_cr (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(255) NOT NULL,
+    content TEXT NOT NULL,
+    usage_count INTEGER DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
 -- App metadata (for auto-increment tracking, etc.)
 CREATE TABLE IF NOT EXISTS app_metadata (
     key VARCHAR(255) PRIMARY KEY,
@@ -513,13 +540,81 @@ CREATE TRIGGER update_payments_updated_at BEFORE UPDATE ON payments
 CREATE TRIGGER update_surgery_plans_updated_at BEFORE UPDATE ON surgery_plans
     FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 
+-- ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+-- DELTA SYNC TRACKING (see GetChanges)
+-- ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+
+-- Rows hard-deleted from the synced tables
+CREATE TABLE IF NOT EXISTS sync_deletions (
+    table_name VARCHAR(64) NOT NULL,
+    row_key BIGINT NOT NULL,
+    sync_txid BIGINT NOT NULL DEFAULT txid_current(),
+    deleted_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_sync_deletions_txid ON sync_deletions(sync_txid);
+
+CREATE OR REPLACE FUNCTION track_sync_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.sync_txid = txid_current();
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+-- TG_ARGV[0] is the primary key column of the table
+CREATE OR REPLACE FUNCTION track_sync_deletion()
+RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO sync_deletions (table_name, row_key)
+    VALUES (TG_TABLE_NAME, (to_jsonb(OLD) ->> TG_ARGV[0])::BIGINT);
+    RETURN OLD;
+END;
+$$ language 'plpgsql';
+
+CREATE INDEX IF NOT EXISTS idx_patients_sync ON patients(sync_txid);
+CREATE TRIGGER patients_sync_change BEFORE INSERT OR UPDATE ON patients
+    FOR EACH ROW EXECUTE FUNCTION track_sync_change();
+CREATE TRIGGER patients_sync_deletion AFTER DELETE ON patients
+    FOR EACH ROW EXECUTE FUNCTION track_sync_deletion('code');
+
+CREATE INDEX IF NOT EXISTS idx_visits_sync ON visits(sync_txid);
+CREATE TRIGGER visits_sync_change BEFORE INSERT OR UPDATE ON visits
+    FOR EACH ROW EXECUTE FUNCTION track_sync_change();
+CREATE TRIGGER visits_sync_deletion AFTER DELETE ON visits
+    FOR EACH ROW EXECUTE FUNCTION track_sync_deletion('id');
+
+CREATE INDEX IF NOT EXISTS idx_payments_sync ON payments(sync_txid);
+CREATE TRIGGER payments_sync_change BEFORE INSERT OR UPDATE ON payments
+    FOR EACH ROW EXECUTE FUNCTION track_sync_change();
+CREATE TRIGGER payments_sync_deletion AFTER DELETE ON payments
+    FOR EACH ROW EXECUTE FUNCTION track_sync_deletion('id');
+
+CREATE INDEX IF NOT EXISTS idx_ordonnances_sync ON ordonnances(sync_txid);
+CREATE TRIGGER ordonnances_sync_change BEFORE INSERT OR UPDATE ON ordonnances
+    FOR EACH ROW EXECUTE FUNCTION track_sync_change();
+CREATE TRIGGER ordonnances_sync_deletion AFTER DELETE ON ordonnances
+    FOR EACH ROW EXECUTE FUNCTION track_sync_deletion('id');
+
+CREATE INDEX IF NOT EXISTS idx_appointments_sync ON appointments(sync_txid);
+CREATE TRIGGER appointments_sync_change BEFORE INSERT OR UPDATE ON appointments
+    FOR EACH ROW EXECUTE FUNCTION track_sync_change();
+CREATE TRIGGER appointments_sync_deletion AFTER DELETE ON appointments
+    FOR EACH ROW EXECUTE FUNCTION track_sync_deletion('id');
+
+CREATE INDEX IF NOT EXISTS idx_surgery_plans_sync ON surgery_plans(sync_txid);
+CREATE TRIGGER surgery_plans_sync_change BEFORE INSERT OR UPDATE ON surgery_plans
+    FOR EACH ROW EXECUTE FUNCTION track_sync_change();
+CREATE TRIGGER surgery_plans_sync_deletion AFTER DELETE ON surgery_plans
+    FOR EACH ROW EXECUTE FUNCTION track_sync_deletion('id');
+
 -- ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
 -- SEED DATA
 -- ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
 
--- Insert default admin user
+-- Insert default admin user (bcrypt hash of the default password - change it after first login)
 INSERT INTO users (id, name, role, password_hash, is_template_user, needs_sync)
-VALUES ('admin', 'Administrateur', 'Administrateur', 'ophfares2016', FALSE, FALSE)
+VALUES ('admin', 'Administrateur', 'Administrateur', '$2a$12$6irh5VGVtATIk8x7YBk.eu9RwXYUsLVtztvlvC/vonMTMDL0J9bxm', FALSE, FALSE)
 ON CONFLICT (id) DO NOTHING;
 
 -- Insert default message templates
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"net/http"
+
+	"medicore/internal/models"
+	"medicore/internal/validation"
+)
+
+// dayLayout formats the days carried by schedule events
+const dayLayout = "2006-01-02"
+
+// dateRequest is the body of requests listing the rows of a day
+type dateRequest struct {
+	Date models.Timestamp `json:"date"`
+}
+
+func (req *dateRequest) Validate(v *validation.Validator) {
+	v.RequiredTime("date", req.Date)
+}
+
+// appointmentRequest is the body of CreateAppointment
+type appointmentRequest struct{ models.Appointment }
+
+func (req *appointmentRequest) Validate(v *validation.Validator) {
+	v.RequiredTime("appointment_date", req.AppointmentDate)
+	v.Required("first_name", req.FirstName)
+	v.Required("last_name", req.LastName)
+	if req.Age != nil {
+		v.Range("age", int64(*req.Age), 0, 150)
+	}
+	if req.DateOfBirth != nil {
+		v.Time("date_of_birth", *req.DateOfBirth)
+	}
+	if req.ExistingPatientCode != nil {
+		v.Min("existing_patient_code", int64(*req.ExistingPatientCode), 0)
+	}
+}
+
+// appointmentDateRequest is the body of UpdateAppointmentDate
+type appointmentDateRequest struct {
+	ID      int64            `json:"id"`
+	NewDate models.Timestamp `json:"new_date"`
+}
+
+func (req *appointmentDateRequest) Validate(v *validation.Validator) {
+	v.RequiredID("id", req.ID)
+	v.RequiredTime("new_date", req.NewDate)
+}
+
+// ==================== APPOINTMENT HANDLERS ====================
+
+func (h *RESTHandler) GetAppointmentsForDate(w http.ResponseWriter, r *http.Request) {
+	var req dateRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	appointments, err := h.appointments.GetForDate(req.Date.Time)
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	respondJSON(w, map[string]interface{}{"appointments": appointments})
+}
+
+func (h *RESTHandler) GetAllAppointments(w http.ResponseWriter, r *http.Request) {
+	appointments, err := h.appointments.GetAll()
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	respondJSON(w, map[string]interface{}{"appointments": appointments})
+}
+
+func (h *RESTHandler) CreateAppointment(w http.ResponseWriter, r *http.Request) {
+	var req appointmentRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+	if req.DateOfBirth != nil && req.DateOfBirth.IsZero() {
+		req.DateOfBirth = nil
+	}
+
+	id, err := h.appointments.Create(&req.Appointment)
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+
+	created := SchedulePayload{ID: id, Date: req.AppointmentDate.Format(dayLayout)}
+	if req.ExistingPatientCode != nil {
+		created.PatientCode = *req.ExistingPatientCode
+	}
+	h.hub.BroadcastAppointmentEvent(EventAppointmentCreated, created)
+
+	respondJSON(w, map[string]interface{}{"id": id})
+}
+
+func (h *RESTHandler) UpdateAppointmentDate(w http.ResponseWriter, r *http.Request) {
+	var req appointmentDateRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	if err := h.appointments.UpdateDate(req.ID, req.NewDate.Time); err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	h.hub.BroadcastAppointmentEvent(EventAppointmentUpdated, SchedulePayload{ID: req.ID, Date: req.NewDate.Format(dayLayout)})
+	respondJSON(w, map[string]interface{}{"success": true})
+}
+
+func (h *RESTHandler) MarkAppointmentAsAdded(w http.ResponseWriter, r *http.Request) {
+	var req idRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	if err := h.appointments.MarkAsAdded(req.ID); err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	h.hub.BroadcastAppointmentEvent(EventAppointmentUpdated, SchedulePayload{ID: req.ID})
+	respondJSON(w, map[string]interface{}{"success": true})
+}
+
+func (h *RESTHandler) DeleteAppointment(w http.ResponseWriter, r *http.Request) {
+	var req idRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	if err := h.appointments.Delete(req.ID); err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	h.hub.BroadcastAppointmentEvent(EventAppointmentDeleted, SchedulePayload{ID: req.ID})
+	respondJSON(w, map[string]interface{}{"success": true})
+}
+
+func (h *RESTHandler) CleanupPastAppointments(w http.ResponseWriter, r *http.Request) {
+	deleted, err := h.appointments.DeletePastNotAdded()
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	if deleted > 0 {
+		h.hub.BroadcastAppointmentEvent(EventAppointmentsCleaned, CountPayload{Count: deleted})
+	}
+	respondJSON(w, map[string]interface{}{"deleted": deleted})
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"medicore/internal/middleware"
+	"medicore/internal/services"
+	"medicore/internal/validation"
+)
+
+// auditLogRequest is the body expected by /api/GetAuditLog
+type auditLogRequest struct {
+	TableName string `json:"table_name"`
+	RecordID  string `json:"record_id"`
+	UserID    string `json:"user_id"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Limit     int    `json:"limit"`
+}
+
+func (req *auditLogRequest) Validate(v *validation.Validator) {
+	if _, _, err := parseAuditTime(req.From); req.From != "" && err != nil {
+		v.Add("from", "must be a date (YYYY-MM-DD or RFC3339)")
+	}
+	if _, _, err := parseAuditTime(req.To); req.To != "" && err != nil {
+		v.Add("to", "must be a date (YYYY-MM-DD or RFC3339)")
+	}
+	v.Min("limit", int64(req.Limit), 0)
+}
+
+// snapshot returns the current state of an audited row. Errors are logged
+// and yield nil so auditing never blocks the request itself.
+func (h *RESTHandler) snapshot(table string, recordID interface{}) json.RawMessage {
+	raw, err := h.audit.Snapshot(table, recordID)
+	if err != nil {
+		log.Printf("⚠️ Audit snapshot failed: %v", err)
+	}
+	return raw
+}
+
+// snapshotWhere returns every row of a table matching a condition
+func (h *RESTHandler) snapshotWhere(table, condition string, args ...interface{}) json.RawMessage {
+	raw, err := h.audit.SnapshotWhere(table, condition, args...)
+	if err != nil {
+		log.Printf("⚠️ Audit snapshot failed: %v", err)
+	}
+	return raw
+}
+
+// recordAudit writes an audit_log entry for a mutation made by the
+// request's user
+func (h *RESTHandler) recordAudit(r *http.Request, action, table string, recordID interface{}, oldValues, newValues json.RawMessage) {
+	err := h.audit.Record(services.AuditEntry{
+		UserID:    middleware.GetUserID(r),
+		Action:    action,
+		TableName: table,
+		RecordID:  fmt.Sprint(recordID),
+		OldValues: oldValues,
+		NewValues: newValues,
+		IPAddress: clientIP(r),
+	})
+	if err != nil {
+		log.Printf("⚠️ %v", err)
+	}
+}
+
+// GetAuditLog returns audit entries filtered by table, record, user and
+// date range (YYYY-MM-DD or RFC3339; a date-only "to" is inclusive)
+func (h *RESTHandler) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	var req auditLogRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	filter := services.AuditFilter{
+		TableName: req.TableName,
+		RecordID:  req.RecordID,
+		UserID:    req.UserID,
+		Limit:     req.Limit,
+	}
+
+	// Both dates were checked by Validate
+	if req.From != "" {
+		filter.From, _, _ = parseAuditTime(req.From)
+	}
+	if req.To != "" {
+		var dateOnly bool
+		filter.To, dateOnly, _ = parseAuditTime(req.To)
+		if dateOnly {
+			filter.To = filter.To.AddDate(0, 0, 1)
+		}
+	}
+
+	entries, err := h.audit.Query(filter)
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+
+	respondJSON(w, map[string]interface{}{"entries": entries})
+}
+
+// parseAuditTime accepts a date or an RFC3339 timestamp
+func parseAuditTime(value string) (t time.Time, dateOnly bool, err error) {
+	if t, err = time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, true, nil
+	}
+	t, err = time.Parse(time.RFC3339, value)
+	return t, false, err
+}
@@ -0,0 +1,246 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"medicore/internal/middleware"
+	"medicore/internal/services"
+	"medicore/internal/validation"
+)
+
+// loginRequest is the body expected by /api/auth/login
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (req *loginRequest) Validate(v *validation.Validator) {
+	v.Required("username", req.Username)
+	v.Check(req.Password != "", "password", "is required")
+}
+
+// changePasswordRequest is the body expected by /api/auth/change-password
+type changePasswordRequest struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+func (req *changePasswordRequest) Validate(v *validation.Validator) {
+	v.Check(req.OldPassword != "", "old_password", "is required")
+	v.Check(req.NewPassword != "", "new_password", "is required")
+}
+
+// SetupAuthRoutes registers the session endpoints
+func (h *RESTHandler) SetupAuthRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/auth/login", withCORS(h.Login))
+	mux.HandleFunc("/api/auth/logout", withCORS(h.Logout))
+	mux.HandleFunc("/api/auth/refresh", withCORS(h.RefreshSession))
+	mux.HandleFunc("/api/auth/me", withCORS(h.Me))
+	mux.HandleFunc("/api/auth/change-password", withCORS(h.ChangePassword))
+	mux.HandleFunc("/api/health", withCORS(h.Health))
+}
+
+// ==================== AUTH HANDLERS ====================
+
+// Login checks a username/password pair and opens a new session
+func (h *RESTHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	username := strings.TrimSpace(req.Username)
+
+	// Names are not unique, so try every active account matching the name or id
+	rows, err := h.db.Query(`
+		SELECT id, name, role, password_hash, percentage
+		FROM users WHERE (name = $1 OR id = $1) AND deleted_at IS NULL
+	`, username)
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	var user map[string]interface{}
+	var needsRehash bool
+	for rows.Next() {
+		var id, name, role, passwordHash string
+		var percentage sql.NullFloat64
+		if err := rows.Scan(&id, &name, &role, &passwordHash, &percentage); err != nil {
+			continue
+		}
+		ok, rehash := middleware.CheckPassword(passwordHash, req.Password)
+		if !ok {
+			continue
+		}
+		needsRehash = rehash
+		user = map[string]interface{}{
+			"id":        id,
+			"username":  name,
+			"full_name": name,
+			"role":      role,
+		}
+		if percentage.Valid {
+			user["percentage"] = percentage.Float64
+		}
+		break
+	}
+	rows.Close()
+
+	if user == nil {
+		respondError(w, 401, "invalid username or password")
+		return
+	}
+
+	// Upgrade legacy plaintext (or weaker) passwords now that we know the plaintext
+	if needsRehash {
+		if err := h.setUserPassword(user["id"].(string), req.Password); err != nil {
+			log.Printf("⚠️ Could not rehash password of user %s: %v", user["id"], err)
+		}
+	}
+
+	token, expiresAt, err := h.auth.CreateSession(user["id"].(string), clientIP(r), r.UserAgent())
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+
+	respondJSON(w, map[string]interface{}{
+		"token":      token,
+		"expires_at": expiresAt.Format(time.RFC3339),
+		"user":       user,
+	})
+}
+
+// Logout revokes the session used to make the request
+func (h *RESTHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if err := h.auth.DeleteSession(middleware.GetSessionToken(r)); err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	respondJSON(w, map[string]interface{}{"success": true})
+}
+
+// RefreshSession swaps the current session token for a fresh one
+func (h *RESTHandler) RefreshSession(w http.ResponseWriter, r *http.Request) {
+	token, expiresAt, err := h.auth.RefreshSession(middleware.GetSessionToken(r), clientIP(r), r.UserAgent())
+	if errors.Is(err, middleware.ErrInvalidSession) {
+		respondError(w, 401, err.Error())
+		return
+	}
+	if err != nil {
+		respondError(w, 503, err.Error())
+		return
+	}
+
+	respondJSON(w, map[string]interface{}{
+		"token":      token,
+		"expires_at": expiresAt.Format(time.RFC3339),
+	})
+}
+
+// Me returns the user owning the current session
+func (h *RESTHandler) Me(w http.ResponseWriter, r *http.Request) {
+	row := h.db.QueryRow(`
+		SELECT id, name, role, percentage
+		FROM users WHERE id = $1 AND deleted_at IS NULL
+	`, middleware.GetUserID(r))
+
+	var id, name, role string
+	var percentage sql.NullFloat64
+	if err := row.Scan(&id, &name, &role, &percentage); err != nil {
+		respondError(w, 401, "user no longer exists")
+		return
+	}
+
+	user := map[string]interface{}{
+		"id":        id,
+		"username":  name,
+		"full_name": name,
+		"role":      role,
+	}
+	if percentage.Valid {
+		user["percentage"] = percentage.Float64
+	}
+
+	respondJSON(w, map[string]interface{}{"user": user})
+}
+
+// ChangePassword lets the current user replace their password after
+// confirming the old one. Other sessions of the user are revoked.
+func (h *RESTHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req changePasswordRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	userID := middleware.GetUserID(r)
+	var stored string
+	if err := h.db.QueryRow(`SELECT password_hash FROM users WHERE id = $1 AND deleted_at IS NULL`, userID).Scan(&stored); err != nil {
+		respondError(w, 401, "user no longer exists")
+		return
+	}
+	if ok, _ := middleware.CheckPassword(stored, req.OldPassword); !ok {
+		respondError(w, 403, "old password is incorrect")
+		return
+	}
+
+	oldValues := h.snapshot("users", userID)
+	if err := h.setUserPassword(userID, req.NewPassword); err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	// Snapshots never include the hash
+	h.recordAudit(r, services.AuditUpdate, "users", userID, oldValues, h.snapshot("users", userID))
+	if err := h.auth.DeleteOtherSessions(userID, middleware.GetSessionToken(r)); err != nil {
+		log.Printf("⚠️ Could not revoke sessions of user %s: %v", userID, err)
+	}
+
+	respondJSON(w, map[string]interface{}{"success": true})
+}
+
+// setUserPassword hashes and stores a new password for a user
+func (h *RESTHandler) setUserPassword(userID, password string) error {
+	hash, err := middleware.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	_, err = h.db.Exec(`UPDATE users SET password_hash = $1, updated_at = NOW() WHERE id = $2`, hash, userID)
+	return err
+}
+
+// Health reports whether the server and its database are reachable, and
+// the state of the backups
+func (h *RESTHandler) Health(w http.ResponseWriter, r *http.Request) {
+	status := map[string]interface{}{
+		"status":      "ok",
+		"server_time": time.Now().UnixMilli(),
+	}
+	if err := h.db.Ping(); err != nil {
+		status["status"] = "degraded"
+		status["database"] = err.Error()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		status["database"] = "ok"
+	}
+	status["backup"] = h.backupHealth()
+	respondJSON(w, status)
+}
+
+// clientIP returns the remote address of a request without its port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
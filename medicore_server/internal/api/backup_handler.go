@@ -0,0 +1,249 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"medicore/internal/middleware"
+	"medicore/internal/services"
+	"medicore/internal/validation"
+)
+
+// backupRequest is the body of requests addressing a backup by file name
+type backupRequest struct {
+	Name string `json:"name"`
+}
+
+func (req *backupRequest) Validate(v *validation.Validator) {
+	v.Required("name", req.Name)
+}
+
+// SetBackups makes the backup endpoints use a backup service. Without one
+// they answer 503.
+func (h *RESTHandler) SetBackups(backups *services.BackupService) {
+	h.backups = backups
+}
+
+// SetBackupVerifier makes the verification endpoint use a verifier, and
+// alerts the administrators when a backup fails its verification
+func (h *RESTHandler) SetBackupVerifier(verifier *services.BackupVerifier) {
+	h.verifier = verifier
+	verifier.OnResult(func(result services.BackupVerification) {
+		if !result.Passed {
+			h.hub.SendToRoles(NewEvent(EventBackupVerificationFailed, BackupAlertPayload{
+				Backup: result.Backup,
+				Error:  result.Error,
+			}), middleware.RoleAdmin)
+		}
+	})
+}
+
+// requireBackups answers 503 when backups are not configured
+func (h *RESTHandler) requireBackups(w http.ResponseWriter) bool {
+	if h.backups == nil {
+		respondError(w, http.StatusServiceUnavailable, "backups are not configured")
+		return false
+	}
+	return true
+}
+
+// respondBackupError maps backup service errors to HTTP statuses
+func respondBackupError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrBackupNotFound):
+		respondError(w, 404, err.Error())
+	case errors.Is(err, services.ErrNoRollback):
+		respondError(w, 404, err.Error())
+	case errors.Is(err, services.ErrBackupBusy):
+		respondError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrBackupCorrupt), errors.Is(err, services.ErrBackupKeyMissing),
+		errors.Is(err, services.ErrRestoreInvalid):
+		respondError(w, http.StatusUnprocessableEntity, err.Error())
+	case errors.Is(err, services.ErrRestoreNotConfigured):
+		respondError(w, http.StatusServiceUnavailable, err.Error())
+	default:
+		respondError(w, 500, err.Error())
+	}
+}
+
+// backupHealth is the backup part of Health
+func (h *RESTHandler) backupHealth() string {
+	if h.backups == nil {
+		return "disabled"
+	}
+	return h.backups.Health()
+}
+
+// ==================== BACKUP HANDLERS ====================
+
+// GetBackups lists the backups, newest first, with their manifest and the
+// backup status
+func (h *RESTHandler) GetBackups(w http.ResponseWriter, r *http.Request) {
+	if !h.requireBackups(w) {
+		return
+	}
+
+	backups, err := h.backups.ListBackups()
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+
+	respondJSON(w, map[string]interface{}{
+		"backups":   backups,
+		"status":    h.backups.Status(),
+		"encrypted": h.backups.Encrypted(),
+	})
+}
+
+// CreateBackup makes a backup now and waits for it
+func (h *RESTHandler) CreateBackup(w http.ResponseWriter, r *http.Request) {
+	if !h.requireBackups(w) {
+		return
+	}
+
+	if _, err := h.backups.CreateBackup(); err != nil {
+		respondBackupError(w, err)
+		return
+	}
+
+	status := h.backups.Status()
+	h.recordAudit(r, services.AuditCreate, "backups", status.LastBackup, nil, nil)
+	respondJSON(w, status)
+}
+
+// DownloadBackup sends a backup file
+func (h *RESTHandler) DownloadBackup(w http.ResponseWriter, r *http.Request) {
+	if !h.requireBackups(w) {
+		return
+	}
+
+	var req backupRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	file, err := h.backups.OpenBackup(req.Name)
+	if err != nil {
+		respondBackupError(w, err)
+		return
+	}
+	defer file.Close()
+
+	contentType := "application/gzip"
+	if strings.HasSuffix(req.Name, ".enc") {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+req.Name+`"`)
+	if info, err := file.Stat(); err == nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	}
+	io.Copy(w, file)
+}
+
+// VerifyBackup test-restores a backup into a scratch database and waits
+// for the result, which is also recorded with the backup
+func (h *RESTHandler) VerifyBackup(w http.ResponseWriter, r *http.Request) {
+	if !h.requireBackups(w) {
+		return
+	}
+	if h.verifier == nil {
+		respondError(w, http.StatusServiceUnavailable, "backup verification is not configured")
+		return
+	}
+
+	var req backupRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	result, err := h.verifier.Verify(req.Name)
+	if err != nil {
+		respondBackupError(w, err)
+		return
+	}
+	respondJSON(w, result)
+}
+
+// PushBackups uploads the backups missing from the off-site destinations
+// now, and returns the upload status of each destination
+func (h *RESTHandler) PushBackups(w http.ResponseWriter, r *http.Request) {
+	if !h.requireBackups(w) {
+		return
+	}
+
+	h.backups.PushBackups()
+	respondJSON(w, map[string]interface{}{"destinations": h.backups.Status().Destinations})
+}
+
+// RestoreBackup replaces the database with a backup. The current data is
+// backed up first, then the backup is restored into a new database, checked
+// and migrated there, and only then switched in. Requests fail with 503
+// during the switch, and clients are asked to reload their data after it.
+// Backups that fail their checksum, decryption or checks are refused with
+// 422, leaving the data untouched.
+func (h *RESTHandler) RestoreBackup(w http.ResponseWriter, r *http.Request) {
+	if !h.requireBackups(w) {
+		return
+	}
+
+	var req backupRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	result, err := h.backups.RestoreBackup(req.Name, h.pauseForRestore(RestorePayload{Backup: req.Name}))
+	if err != nil {
+		respondBackupError(w, err)
+		return
+	}
+
+	details, _ := json.Marshal(result)
+	h.recordAudit(r, services.AuditRestore, "backups", req.Name, nil, details)
+	h.hub.Broadcast(NewEvent(EventResyncRequired, ResyncPayload{}))
+	respondJSON(w, result)
+}
+
+// RollbackRestore puts back the data replaced by the last restore. Calling
+// it again puts the restored data back.
+func (h *RESTHandler) RollbackRestore(w http.ResponseWriter, r *http.Request) {
+	if !h.requireBackups(w) {
+		return
+	}
+
+	result, err := h.backups.RollbackRestore(h.pauseForRestore(RestorePayload{Rollback: true}))
+	if err != nil {
+		respondBackupError(w, err)
+		return
+	}
+
+	details, _ := json.Marshal(result)
+	h.recordAudit(r, services.AuditRestore, "backups", result.RollbackDatabase, nil, details)
+	h.hub.Broadcast(NewEvent(EventResyncRequired, ResyncPayload{}))
+	respondJSON(w, result)
+}
+
+// pauseForRestore returns the pause function of a restore: requests are
+// refused and clients told until the databases are switched, or the switch
+// failed
+func (h *RESTHandler) pauseForRestore(payload RestorePayload) func() func(error) {
+	return func() func(error) {
+		h.maintenance.Store(true)
+		h.hub.Broadcast(NewEvent(EventRestoreStarted, payload))
+		return func(err error) {
+			if err != nil {
+				payload.Error = err.Error()
+			}
+			h.maintenance.Store(false)
+			h.hub.Broadcast(NewEvent(EventRestoreFinished, payload))
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	_ "github.com/lib/pq"
+
+	"medicore/internal/middleware"
+)
+
+func TestPauseForRestoreReportsTheSwitch(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantErr string
+	}{
+		{"switched", nil, ""},
+		{"failed", errors.New("failed to rename the live database"), "failed to rename the live database"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &RESTHandler{hub: startHub(t, 0)}
+			watcher := connect(t, h.hub, "c1", "admin", "Administrateur")
+
+			resume := h.pauseForRestore(RestorePayload{Backup: "backup.sql.gz"})()
+			if !h.maintenance.Load() {
+				t.Error("requests still served during the switch")
+			}
+			waitFor(t, watcher, EventRestoreStarted)
+
+			resume(tt.err)
+			if h.maintenance.Load() {
+				t.Error("requests still refused after the switch")
+			}
+			event, _ := waitFor(t, watcher, EventRestoreFinished)
+			payload := event.Data.(RestorePayload)
+			if payload.Backup != "backup.sql.gz" || payload.Error != tt.wantErr {
+				t.Errorf("restore_finished %#v, want error %q", payload, tt.wantErr)
+			}
+		})
+	}
+}
+
+// During the switch sessions cannot be checked: every route, those skipping
+// authentication included, must answer 503 rather than 401
+func TestMaintenanceComesBeforeAuthentication(t *testing.T) {
+	db, err := sql.Open("postgres", "postgres://localhost/unused?sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	h := &RESTHandler{}
+	reached := false
+	handler := middleware.ChainMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}),
+		middleware.RecoveryMiddleware,
+		middleware.CORSMiddleware,
+		h.MaintenanceMiddleware,
+		middleware.NewAuthMiddleware(db).Middleware,
+	)
+	serve := func(path, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	h.maintenance.Store(true)
+	for _, path := range []string{"/api/GetAllPatients", "/api/events", "/api/auth/login", "/api/auth/refresh", "/api/health"} {
+		for _, token := range []string{"", "some-token"} {
+			w := serve(path, token)
+			if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+				t.Errorf("%s (token %q): status %d, Retry-After %q, want 503 with Retry-After", path, token, w.Code, w.Header().Get("Retry-After"))
+			}
+		}
+	}
+	if reached {
+		t.Error("a request reached the routes during the switch")
+	}
+
+	h.maintenance.Store(false)
+	if w := serve("/api/GetAllPatients", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("after the switch: status %d, want 401", w.Code)
+	}
+	if w := serve("/api/health", ""); w.Code != http.StatusOK || !reached {
+		t.Errorf("after the switch: health status %d, reached %v", w.Code, reached)
+	}
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// eventChannel is the NOTIFY channel shared by every server instance
+	eventChannel = "medicore_events"
+
+	// maxNotifyPayload is the PostgreSQL limit on a NOTIFY payload
+	maxNotifyPayload = 8000
+)
+
+// relayedEvent is the NOTIFY payload: an event with its delivery targeting,
+// which is left out of the JSON sent to clients
+type relayedEvent struct {
+	Event
+	TargetUserID string   `json:"target_user_id,omitempty"`
+	TargetRoles  []string `json:"target_roles,omitempty"`
+	Origin       string   `json:"origin,omitempty"` // Instance that sent a resync notice, which skips it
+}
+
+// EventRelay fans events out to every server instance sharing the database.
+// Events are published with NOTIFY; each instance LISTENs and hands what it
+// receives, its own events included, to its local hub.
+type EventRelay struct {
+	db       *sql.DB
+	hub      *EventHub
+	listener *pq.Listener
+	origin   string // Identifies this instance in the resync notices it sends
+}
+
+// StartEventRelay starts listening for events and makes the hub publish
+// through PostgreSQL
+func StartEventRelay(hub *EventHub, db *sql.DB, connStr string) (*EventRelay, error) {
+	relay := &EventRelay{db: db, hub: hub, origin: fmt.Sprintf("%d_%d", os.Getpid(), time.Now().UnixNano())}
+
+	relay.listener = pq.NewListener(connStr, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("⚠️ Event relay: %v", err)
+		}
+	})
+	if err := relay.listener.Listen(eventChannel); err != nil {
+		relay.listener.Close()
+		return nil, fmt.Errorf("failed to listen on %s: %w", eventChannel, err)
+	}
+
+	go relay.listen()
+	hub.setRelay(relay)
+
+	log.Printf("📡 Event relay listening on PostgreSQL channel %s", eventChannel)
+	return relay, nil
+}
+
+// Publish sends an event to every instance. When the event cannot be
+// relayed, the other instances are asked to make their clients resync
+// instead, and the error is returned for the caller to deliver the event
+// locally.
+func (r *EventRelay) Publish(event Event) error {
+	err := r.publish(relayedEvent{
+		Event:        event,
+		TargetUserID: event.TargetUserID,
+		TargetRoles:  event.TargetRoles,
+	})
+	if err == nil {
+		return nil
+	}
+
+	notice := relayedEvent{Event: NewEvent(EventResyncRequired, ResyncPayload{}), Origin: r.origin}
+	if noticeErr := r.publish(notice); noticeErr != nil {
+		log.Printf("⚠️ Event relay: failed to ask other instances to resync: %v", noticeErr)
+	}
+	return err
+}
+
+// publish sends a NOTIFY, if the payload fits in one
+func (r *EventRelay) publish(relayed relayedEvent) error {
+	payload, err := json.Marshal(relayed)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxNotifyPayload {
+		return fmt.Errorf("%s event too large to relay (%d bytes)", relayed.Type, len(payload))
+	}
+
+	_, err = r.db.Exec(`SELECT pg_notify($1, $2)`, eventChannel, string(payload))
+	return err
+}
+
+// listen hands the relayed events to the local hub
+func (r *EventRelay) listen() {
+	for {
+		select {
+		case notification, ok := <-r.listener.Notify:
+			if !ok {
+				return
+			}
+			if notification == nil {
+				// The connection was lost and re-established: events sent in
+				// between never reached this instance
+				log.Println("⚠️ Event relay reconnected, asking clients to resync")
+				r.hub.deliver(NewEvent(EventResyncRequired, ResyncPayload{}))
+				continue
+			}
+
+			var relayed relayedEvent
+			if err := json.Unmarshal([]byte(notification.Extra), &relayed); err != nil {
+				log.Printf("⚠️ Event relay: invalid payload: %v", err)
+				continue
+			}
+			if relayed.Origin == r.origin {
+				// Our clients got the event that could not be relayed
+				continue
+			}
+			event := relayed.Event
+			event.TargetUserID = relayed.TargetUserID
+			event.TargetRoles = relayed.TargetRoles
+			r.hub.deliver(event)
+
+		case <-time.After(90 * time.Second):
+			// Detect dead connections when no event is flowing
+			go r.listener.Ping()
+		}
+	}
+}
+
+// Close stops listening. The hub goes back to local delivery.
+func (r *EventRelay) Close() error {
+	r.hub.setRelay(nil)
+	return r.listener.Close()
+}
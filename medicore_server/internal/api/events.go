@@ -0,0 +1,370 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// EventSchemaVersion is the version of the event payloads below. Bump it
+// when a payload changes in a way clients must know about.
+const EventSchemaVersion = 1
+
+// ==================== EVENT PAYLOADS ====================
+// Field docs are served by /api/events/schema.
+
+// PatientPayload is the payload of patient events
+type PatientPayload struct {
+	PatientCode int    `json:"patient_code" doc:"Code of the patient"`
+	FirstName   string `json:"first_name,omitempty" doc:"First name, on creation and import"`
+	LastName    string `json:"last_name,omitempty" doc:"Last name, on creation and import"`
+}
+
+// RecordPayload identifies the row an event is about by numeric id
+type RecordPayload struct {
+	ID int64 `json:"id" doc:"ID of the row"`
+}
+
+// KeyPayload identifies the row an event is about by text id
+type KeyPayload struct {
+	ID string `json:"id" doc:"ID of the row"`
+}
+
+// PatientRecordPayload identifies a row belonging to a patient
+type PatientRecordPayload struct {
+	ID          int64 `json:"id" doc:"ID of the row"`
+	PatientCode int   `json:"patient_code" doc:"Code of the patient owning the row"`
+}
+
+// MessageCreatedPayload is the payload of message_created
+type MessageCreatedPayload struct {
+	ID         int64  `json:"id" doc:"ID of the message"`
+	SenderName string `json:"sender_name" doc:"Name of the sender"`
+	Direction  string `json:"direction" doc:"to_nurse or to_doctor"`
+	Content    string `json:"content" doc:"Text of the message"`
+}
+
+// MessagesClearedPayload is the payload of messages_cleared
+type MessagesClearedPayload struct {
+	Direction string `json:"direction" doc:"Direction of the cleared messages: to_nurse or to_doctor"`
+}
+
+// WaitingAddedPayload is the payload of waiting_added and dilatation_added
+type WaitingAddedPayload struct {
+	ID               int64  `json:"id" doc:"ID of the queue entry"`
+	PatientCode      int    `json:"patient_code" doc:"Code of the patient"`
+	PatientFirstName string `json:"patient_first_name" doc:"First name of the patient"`
+	PatientLastName  string `json:"patient_last_name" doc:"Last name of the patient"`
+	IsUrgent         bool   `json:"is_urgent" doc:"Whether the patient must be seen first"`
+	IsDilatation     bool   `json:"is_dilatation" doc:"Whether the entry is a dilatation"`
+	Motif            string `json:"motif" doc:"Reason for the visit"`
+}
+
+// WaitingRemovedPayload is the payload of waiting_removed
+type WaitingRemovedPayload struct {
+	ID          int64 `json:"id,omitempty" doc:"ID of the removed entry, absent when every entry of the patient was removed"`
+	PatientCode int   `json:"patient_code" doc:"Code of the patient"`
+}
+
+// SchedulePayload is the payload of appointment and surgery plan events
+type SchedulePayload struct {
+	ID          int64  `json:"id" doc:"ID of the appointment or surgery plan"`
+	Date        string `json:"date,omitempty" doc:"Day it is scheduled on (YYYY-MM-DD), on creation and when moved"`
+	PatientCode int    `json:"patient_code,omitempty" doc:"Code of the patient, when known"`
+}
+
+// CountPayload is the payload of events about many rows at once
+type CountPayload struct {
+	Count int64 `json:"count" doc:"Number of rows concerned"`
+}
+
+// PaymentPayload is the payload of payment events
+type PaymentPayload struct {
+	ID          int64  `json:"id" doc:"ID of the payment"`
+	PatientCode int    `json:"patient_code,omitempty" doc:"Code of the patient, on creation and update"`
+	Amount      int    `json:"amount,omitempty" doc:"Amount paid, on creation"`
+	UserName    string `json:"user_name,omitempty" doc:"User who collected the payment, on creation"`
+}
+
+// UserPayload is the payload of user events
+type UserPayload struct {
+	ID   string `json:"id" doc:"ID of the user"`
+	Name string `json:"name,omitempty" doc:"Name of the user, on creation"`
+}
+
+// NursePayload is the payload of nurse preference events
+type NursePayload struct {
+	NurseID string `json:"nurse_id" doc:"ID of the nurse"`
+}
+
+// UserPresence is the payload of presence events: a user with their live
+// event stream connections, none when offline
+type UserPresence struct {
+	UserID      string               `json:"user_id" doc:"ID of the user"`
+	Role        string               `json:"role" doc:"Role of the user"`
+	Connections []ConnectionPresence `json:"connections" doc:"Live connections: client_id, workstation, rooms, connected_at, last_seen"`
+}
+
+// ConnectionPresence is one event stream connection of a user
+type ConnectionPresence struct {
+	ClientID    string   `json:"client_id"`
+	Workstation string   `json:"workstation"` // Name sent by the client, or its IP
+	Rooms       []string `json:"rooms"`       // Empty for all rooms
+	ConnectedAt int64    `json:"connected_at"`
+	LastSeen    int64    `json:"last_seen"`
+}
+
+// ConnectedPayload is the payload of connected
+type ConnectedPayload struct {
+	ClientID string   `json:"client_id" doc:"ID of the connection, used to change its subscriptions"`
+	Rooms    []string `json:"rooms" doc:"Rooms the connection is subscribed to, empty for all rooms"`
+}
+
+// ResyncPayload is the payload of resync_required
+type ResyncPayload struct {
+	LastEventID int64 `json:"last_event_id,omitempty" doc:"Last event the client received, if it sent one"`
+}
+
+// SubscriptionPayload is the payload of subscribed
+type SubscriptionPayload struct {
+	Rooms []string `json:"rooms" doc:"Rooms the connection is now subscribed to, empty for all rooms"`
+}
+
+// ErrorPayload is the payload of command_error
+type ErrorPayload struct {
+	Message string `json:"message" doc:"What was wrong with the command"`
+}
+
+// BackupAlertPayload is the payload of backup_verification_failed
+type BackupAlertPayload struct {
+	Backup string `json:"backup" doc:"File name of the backup"`
+	Error  string `json:"error" doc:"First check that failed"`
+}
+
+// RestorePayload is the payload of restore_started and restore_finished
+type RestorePayload struct {
+	Backup   string `json:"backup,omitempty" doc:"File name of the backup restored, empty for a rollback"`
+	Rollback bool   `json:"rollback,omitempty" doc:"Whether the previous data is being put back"`
+	Error    string `json:"error,omitempty" doc:"Why the switch failed; the data was not changed"`
+}
+
+// ==================== EVENT CATALOG ====================
+
+// Delivery scopes of the event types
+const (
+	scopeAll        = "all"        // Every connected client
+	scopeRoom       = "room"       // Clients subscribed to room_id
+	scopeConnection = "connection" // Only the connection concerned
+	scopeAdmins     = "admins"     // Administrators only
+)
+
+// eventSpec describes one event type for /api/events/schema
+type eventSpec struct {
+	Type        EventType
+	Description string
+	Scope       string
+	Payload     interface{} // Zero value of the payload type, nil for none
+}
+
+// eventCatalog lists every event type sent to clients
+var eventCatalog = []eventSpec{
+	{EventPatientCreated, "A patient was created", scopeAll, PatientPayload{}},
+	{EventPatientUpdated, "A patient was updated", scopeAll, PatientPayload{}},
+	{EventPatientDeleted, "A patient and its related data were deleted", scopeAll, PatientPayload{}},
+	{EventPatientRestored, "A deleted patient and its related data were restored", scopeAll, PatientPayload{}},
+
+	{EventMessageCreated, "A message was sent to a room", scopeRoom, MessageCreatedPayload{}},
+	{EventMessageRead, "A message was read (and removed)", scopeRoom, RecordPayload{}},
+	{EventMessagesCleared, "Every message of a room in one direction was read", scopeRoom, MessagesClearedPayload{}},
+	{EventMessageDeleted, "A message was deleted without being read", scopeRoom, RecordPayload{}},
+
+	{EventWaitingAdded, "A patient was sent to a room's queue", scopeRoom, WaitingAddedPayload{}},
+	{EventDilatationAdded, "A patient was sent to a room's queue for dilatation", scopeRoom, WaitingAddedPayload{}},
+	{EventWaitingUpdated, "A queue entry was checked or changed", scopeRoom, RecordPayload{}},
+	{EventWaitingRemoved, "A patient left a room's queue", scopeRoom, WaitingRemovedPayload{}},
+	{EventDilatationsNotified, "The dilatations of a room's queue were notified", scopeRoom, nil},
+
+	{EventPaymentCreated, "A payment was recorded", scopeAll, PaymentPayload{}},
+	{EventPaymentUpdated, "A payment was changed", scopeAll, PaymentPayload{}},
+	{EventPaymentDeleted, "A payment was cancelled", scopeAll, PaymentPayload{}},
+
+	{EventUserCreated, "A user was created", scopeAll, UserPayload{}},
+	{EventUserUpdated, "A user was updated", scopeAll, UserPayload{}},
+	{EventUserDeleted, "A user was deleted", scopeAll, UserPayload{}},
+
+	{EventTemplateCreated, "A user template was created", scopeAll, KeyPayload{}},
+	{EventTemplateUpdated, "A user template was updated", scopeAll, KeyPayload{}},
+	{EventTemplateDeleted, "A user template was deleted", scopeAll, KeyPayload{}},
+
+	{EventRoomCreated, "A room was created", scopeAll, KeyPayload{}},
+	{EventRoomUpdated, "A room was updated", scopeAll, KeyPayload{}},
+	{EventRoomDeleted, "A room was deleted", scopeAll, KeyPayload{}},
+
+	{EventVisitCreated, "A visit was created", scopeAll, PatientRecordPayload{}},
+	{EventVisitUpdated, "A visit was updated", scopeAll, PatientRecordPayload{}},
+	{EventVisitDeleted, "A visit was deleted", scopeAll, PatientRecordPayload{}},
+
+	{EventOrdonnanceCreated, "A document was created", scopeAll, PatientRecordPayload{}},
+	{EventOrdonnanceUpdated, "A document was updated", scopeAll, PatientRecordPayload{}},
+	{EventOrdonnanceDeleted, "A document was deleted", scopeAll, PatientRecordPayload{}},
+
+	{EventMedicalActCreated, "A medical act was created", scopeAll, RecordPayload{}},
+	{EventMedicalActUpdated, "A medical act was updated", scopeAll, RecordPayload{}},
+	{EventMedicalActDeleted, "A medical act was deleted", scopeAll, RecordPayload{}},
+	{EventMedicalActReorder, "The medical acts were reordered", scopeAll, nil},
+
+	{EventMsgTemplateCreated, "A message template was created", scopeAll, RecordPayload{}},
+	{EventMsgTemplateUpdated, "A message template was updated", scopeAll, RecordPayload{}},
+	{EventMsgTemplateDeleted, "A message template was deleted", scopeAll, RecordPayload{}},
+	{EventMsgTemplateReorder, "The message templates were reordered", scopeAll, nil},
+
+	{EventMedicationCreated, "A medication was created", scopeAll, RecordPayload{}},
+	{EventMedicationUpdated, "A medication or its usage count was updated", scopeAll, RecordPayload{}},
+	{EventMedicationDeleted, "A medication was deleted", scopeAll, RecordPayload{}},
+
+	{EventTemplateCRUpdated, "A CR template was used", scopeAll, RecordPayload{}},
+
+	{EventAppointmentCreated, "An appointment was made", scopeAll, SchedulePayload{}},
+	{EventAppointmentUpdated, "An appointment was moved or its patient was added", scopeAll, SchedulePayload{}},
+	{EventAppointmentDeleted, "An appointment was cancelled", scopeAll, SchedulePayload{}},
+	{EventAppointmentsCleaned, "Past appointments whose patient never came were deleted", scopeAll, CountPayload{}},
+
+	{EventSurgeryPlanCreated, "A surgery was planned", scopeAll, SchedulePayload{}},
+	{EventSurgeryPlanUpdated, "A surgery plan was changed or rescheduled", scopeAll, SchedulePayload{}},
+	{EventSurgeryPlanDeleted, "A surgery plan was deleted", scopeAll, SchedulePayload{}},
+
+	{EventNursePrefsUpdated, "A nurse changed their rooms", scopeAll, NursePayload{}},
+	{EventNurseActive, "A nurse came online (also sent as user_online)", scopeAll, NursePayload{}},
+	{EventNurseInactive, "A nurse went offline (also sent as user_offline)", scopeAll, NursePayload{}},
+
+	{EventUserOnline, "A user opened their first connection to this server instance", scopeAll, UserPresence{}},
+	{EventUserOffline, "A user closed or timed out their last connection to this server instance", scopeAll, UserPresence{}},
+	{EventPresenceUpdated, "An online user opened or closed a connection, or changed rooms", scopeAll, UserPresence{}},
+
+	{EventBackupVerificationFailed, "A backup failed its test-restore: it may not be usable", scopeAdmins, BackupAlertPayload{}},
+	{EventRestoreStarted, "The data is being replaced: requests fail with 503 until restore_finished", scopeAll, RestorePayload{}},
+	{EventRestoreFinished, "The data was replaced, followed by resync_required, or the switch failed", scopeAll, RestorePayload{}},
+
+	{EventConnected, "First event of a connection", scopeConnection, ConnectedPayload{}},
+	{EventPing, "Keep-alive, every 15 seconds", scopeAll, nil},
+	{EventResyncRequired, "Events were missed or the data was restored: reload all data. Sent to every client, or to a reconnecting connection whose missed events cannot be replayed", scopeAll, ResyncPayload{}},
+	{EventSubscribed, "Reply to a WebSocket subscribe command", scopeConnection, SubscriptionPayload{}},
+	{EventCommandError, "Reply to an invalid WebSocket command", scopeConnection, ErrorPayload{}},
+}
+
+// eventPayloadTypes maps each event type to its payload type
+var eventPayloadTypes = func() map[EventType]reflect.Type {
+	types := make(map[EventType]reflect.Type, len(eventCatalog))
+	for _, spec := range eventCatalog {
+		types[spec.Type] = reflect.TypeOf(spec.Payload)
+	}
+	return types
+}()
+
+// NewEvent creates an event of the current schema version. A payload not
+// matching the catalog is still sent, but logged so it gets fixed.
+func NewEvent(eventType EventType, payload interface{}) Event {
+	if expected, ok := eventPayloadTypes[eventType]; !ok {
+		log.Printf("⚠️ Event %s is missing from the event catalog", eventType)
+	} else if reflect.TypeOf(payload) != expected {
+		log.Printf("⚠️ Event %s sent with a %T payload, expected %v", eventType, payload, expected)
+	}
+
+	return Event{
+		Version:   EventSchemaVersion,
+		Type:      eventType,
+		Data:      payload,
+		Timestamp: time.Now().UnixMilli(),
+	}
+}
+
+// ==================== EVENT SCHEMA ====================
+
+// fieldSchema describes one JSON field
+type fieldSchema struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Optional    bool   `json:"optional"`
+	Description string `json:"description,omitempty"`
+}
+
+// eventSchema describes one event type
+type eventSchema struct {
+	Type        EventType     `json:"type"`
+	Description string        `json:"description"`
+	Scope       string        `json:"scope"`
+	Fields      []fieldSchema `json:"fields"`
+}
+
+// envelopeSchema describes the fields common to every event
+var envelopeSchema = []fieldSchema{
+	{Name: "id", Type: "integer", Optional: true, Description: "Increasing event ID, for Last-Event-ID; absent on connection-scoped events and pings"},
+	{Name: "version", Type: "integer", Description: "Schema version of the payload"},
+	{Name: "type", Type: "string", Description: "Event type"},
+	{Name: "room_id", Type: "string", Optional: true, Description: "Room of room-scoped events"},
+	{Name: "data", Type: "object", Optional: true, Description: "Payload, described per event type"},
+	{Name: "timestamp", Type: "integer", Description: "Server time in Unix milliseconds"},
+}
+
+// EventSchemaHandler describes every event type and its payload fields
+func (h *RESTHandler) EventSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	events := make([]eventSchema, 0, len(eventCatalog))
+	for _, spec := range eventCatalog {
+		events = append(events, eventSchema{
+			Type:        spec.Type,
+			Description: spec.Description,
+			Scope:       spec.Scope,
+			Fields:      payloadFields(reflect.TypeOf(spec.Payload)),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"version":  EventSchemaVersion,
+		"envelope": envelopeSchema,
+		"events":   events,
+	})
+}
+
+// payloadFields describes the JSON fields of a payload struct
+func payloadFields(t reflect.Type) []fieldSchema {
+	fields := []fieldSchema{}
+	if t == nil {
+		return fields
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fields = append(fields, fieldSchema{
+			Name:        name,
+			Type:        jsonType(field.Type),
+			Optional:    strings.Contains(options, "omitempty"),
+			Description: field.Tag.Get("doc"),
+		})
+	}
+	return fields
+}
+
+// jsonType names the JSON type a Go type is encoded as
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "array of " + jsonType(t.Elem())
+	}
+	return "object"
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"sort"
+	"time"
+)
+
+// HubMetrics describes the load of the event hub
+type HubMetrics struct {
+	QueueDepth     int             `json:"queue_depth"`     // Events waiting for the hub
+	QueueCapacity  int             `json:"queue_capacity"`  // Events the hub can hold before dropping
+	EventsDropped  int64           `json:"events_dropped"`  // Events lost since startup, each causing a resync
+	ClientsEvicted int64           `json:"clients_evicted"` // Slow clients disconnected since startup
+	Clients        []ClientMetrics `json:"clients"`
+}
+
+// ClientMetrics describes how far behind a client is
+type ClientMetrics struct {
+	ClientID    string `json:"client_id"`
+	Queued      int    `json:"queued"`        // Events waiting to be written, disconnected at clientEventBuffer
+	LastEventID int64  `json:"last_event_id"` // Last event written to the client
+	AckedID     int64  `json:"acked_id,omitempty"`
+	LagMs       int64  `json:"lag_ms"` // Time the last written event waited to be written
+	LastSeen    int64  `json:"last_seen"`
+}
+
+// sent records that an event was written to the client
+func (c *SSEClient) sent(event Event) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if event.ID > 0 {
+		c.sentID = event.ID
+	}
+	if event.Timestamp > 0 {
+		c.sentLag = time.Since(time.UnixMilli(event.Timestamp))
+	}
+}
+
+// metrics describes the backlog of the client
+func (c *SSEClient) metrics() ClientMetrics {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return ClientMetrics{
+		ClientID:    c.ID,
+		Queued:      len(c.Events),
+		LastEventID: c.sentID,
+		AckedID:     c.ackedID,
+		LagMs:       c.sentLag.Milliseconds(),
+		LastSeen:    c.lastSeen.UnixMilli(),
+	}
+}
+
+// Metrics returns the queue depths, drop counters and per-client lag
+func (h *EventHub) Metrics() HubMetrics {
+	metrics := HubMetrics{
+		QueueDepth:     len(h.broadcast),
+		QueueCapacity:  cap(h.broadcast),
+		EventsDropped:  h.eventsDropped.Load(),
+		ClientsEvicted: h.clientsEvicted.Load(),
+	}
+
+	h.mutex.RLock()
+	metrics.Clients = make([]ClientMetrics, 0, len(h.clients))
+	for _, client := range h.clients {
+		metrics.Clients = append(metrics.Clients, client.metrics())
+	}
+	h.mutex.RUnlock()
+
+	sort.Slice(metrics.Clients, func(i, j int) bool {
+		return metrics.Clients[i].ClientID < metrics.Clients[j].ClientID
+	})
+	return metrics
+}
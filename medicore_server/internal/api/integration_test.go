@@ -0,0 +1,507 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"medicore/internal/middleware"
+	"medicore/internal/testdb"
+)
+
+// testServer serves the API on a throwaway database, wired like main does
+type testServer struct {
+	*httptest.Server
+	db *sql.DB
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	db := testdb.New(t)
+
+	auth := middleware.NewAuthMiddleware(db)
+	h := NewRESTHandler(db, auth)
+	h.Start(context.Background())
+
+	mux := http.NewServeMux()
+	h.SetupAuthRoutes(mux)
+	h.SetupRoutes(mux)
+	h.SetupSSERoutes(mux)
+	srv := httptest.NewServer(middleware.ChainMiddleware(mux,
+		middleware.RecoveryMiddleware,
+		middleware.CORSMiddleware,
+		h.MaintenanceMiddleware,
+		auth.Middleware,
+	))
+	t.Cleanup(func() {
+		srv.Close()
+		h.Stop()
+	})
+	return &testServer{Server: srv, db: db}
+}
+
+// addUser inserts a user whose id is also their login name
+func (s *testServer) addUser(t *testing.T, id, role, password string) {
+	t.Helper()
+	hash, err := middleware.HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.db.Exec(`
+		INSERT INTO users (id, name, role, password_hash, is_template_user, needs_sync)
+		VALUES ($1, $1, $2, $3, FALSE, FALSE)
+	`, id, role, hash)
+	if err != nil {
+		t.Fatalf("add user %s: %v", id, err)
+	}
+}
+
+// login opens a session and returns its token
+func (s *testServer) login(t *testing.T, username, password string) string {
+	t.Helper()
+	var reply struct {
+		Token string `json:"token"`
+	}
+	if code := s.post(t, "", "/api/auth/login", map[string]string{"username": username, "password": password}, &reply); code != http.StatusOK {
+		t.Fatalf("login %s: status %d", username, code)
+	}
+	return reply.Token
+}
+
+// post sends a JSON body to a route, decodes the reply into out unless it
+// is nil and returns the status
+func (s *testServer) post(t *testing.T, token, route string, body, out interface{}) int {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, s.URL+route, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s: %v", route, err)
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s: decode reply: %v", route, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// mustPost is post for calls expected to succeed
+func (s *testServer) mustPost(t *testing.T, token, route string, body, out interface{}) {
+	t.Helper()
+	if code := s.post(t, token, route, body, out); code != http.StatusOK {
+		t.Fatalf("%s: status %d", route, code)
+	}
+}
+
+func TestIntegrationLogin(t *testing.T) {
+	s := newTestServer(t)
+	s.addUser(t, "dr.test", "Médecin", "correct horse")
+
+	if code := s.post(t, "", "/api/GetAllPatients", map[string]string{}, nil); code != http.StatusUnauthorized {
+		t.Errorf("without a session: status %d, want 401", code)
+	}
+	if code := s.post(t, "", "/api/auth/login", map[string]string{"username": "dr.test", "password": "wrong"}, nil); code != http.StatusUnauthorized {
+		t.Errorf("wrong password: status %d, want 401", code)
+	}
+
+	token := s.login(t, "dr.test", "correct horse")
+	var me struct {
+		User map[string]interface{} `json:"user"`
+	}
+	s.mustPost(t, token, "/api/auth/me", map[string]string{}, &me)
+	if me.User["id"] != "dr.test" {
+		t.Errorf("me: got %v", me.User)
+	}
+	if _, ok := me.User["password_hash"]; ok {
+		t.Error("me returns the password hash")
+	}
+
+	s.mustPost(t, token, "/api/auth/logout", map[string]string{}, nil)
+	if code := s.post(t, token, "/api/GetAllPatients", map[string]string{}, nil); code != http.StatusUnauthorized {
+		t.Errorf("after logout: status %d, want 401", code)
+	}
+}
+
+func TestIntegrationLoginRehashesLegacyPasswords(t *testing.T) {
+	s := newTestServer(t)
+	if _, err := s.db.Exec(`
+		INSERT INTO users (id, name, role, password_hash, is_template_user, needs_sync)
+		VALUES ('legacy', 'legacy', 'Assistant 1', 'plaintext', FALSE, FALSE)
+	`); err != nil {
+		t.Fatal(err)
+	}
+
+	s.login(t, "legacy", "plaintext")
+
+	var stored string
+	if err := s.db.QueryRow(`SELECT password_hash FROM users WHERE id = 'legacy'`).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if !middleware.IsPasswordHash(stored) {
+		t.Errorf("password still stored as %q", stored)
+	}
+}
+
+func TestIntegrationPatientLifecycle(t *testing.T) {
+	s := newTestServer(t)
+	s.addUser(t, "dr.test", "Médecin", "doctor pass")
+	s.addUser(t, "nurse.test", "Infirmière", "nurse pass")
+	doctor := s.login(t, "dr.test", "doctor pass")
+	nurse := s.login(t, "nurse.test", "nurse pass")
+
+	var created struct {
+		Code int `json:"code"`
+	}
+	s.mustPost(t, nurse, "/api/CreatePatient", map[string]interface{}{"first_name": "Amina", "last_name": "Benali"}, &created)
+	if created.Code <= 0 {
+		t.Fatalf("created patient code %d", created.Code)
+	}
+	code := created.Code
+
+	getPatient := func() map[string]interface{} {
+		t.Helper()
+		var patient map[string]interface{}
+		s.mustPost(t, doctor, "/api/GetPatientByCode", map[string]int{"patient_code": code}, &patient)
+		return patient
+	}
+
+	patient := getPatient()
+	if patient["first_name"] != "Amina" || patient["barcode"] == "" {
+		t.Fatalf("created patient: %v", patient)
+	}
+
+	s.mustPost(t, nurse, "/api/UpdatePatient", map[string]interface{}{"code": code, "first_name": "Amina", "last_name": "Haddad"}, nil)
+	if patient := getPatient(); patient["last_name"] != "Haddad" {
+		t.Errorf("updated patient: %v", patient)
+	}
+
+	if status := s.post(t, nurse, "/api/DeletePatient", map[string]int{"patient_code": code}, nil); status != http.StatusForbidden {
+		t.Errorf("nurse deleting a patient: status %d, want 403", status)
+	}
+	s.mustPost(t, doctor, "/api/DeletePatient", map[string]int{"patient_code": code}, nil)
+	if patient := getPatient(); len(patient) != 0 {
+		t.Errorf("deleted patient still returned: %v", patient)
+	}
+	if status := s.post(t, doctor, "/api/DeletePatient", map[string]int{"patient_code": code}, nil); status != http.StatusNotFound {
+		t.Errorf("deleting twice: status %d, want 404", status)
+	}
+	if status := s.post(t, nurse, "/api/UpdatePatient", map[string]interface{}{"code": code, "first_name": "Amina", "last_name": "Benali"}, nil); status != http.StatusNotFound {
+		t.Errorf("updating a deleted patient: status %d, want 404", status)
+	}
+
+	s.mustPost(t, doctor, "/api/RestorePatient", map[string]int{"patient_code": code}, nil)
+	if patient := getPatient(); patient["last_name"] != "Haddad" {
+		t.Errorf("restored patient: %v", patient)
+	}
+	if status := s.post(t, doctor, "/api/RestorePatient", map[string]int{"patient_code": code}, nil); status != http.StatusNotFound {
+		t.Errorf("restoring a live patient: status %d, want 404", status)
+	}
+}
+
+func TestIntegrationVisitsAndPayments(t *testing.T) {
+	s := newTestServer(t)
+	s.addUser(t, "dr.test", "Médecin", "doctor pass")
+	s.addUser(t, "nurse.test", "Infirmière", "nurse pass")
+	s.addUser(t, "assistant.test", "Assistant 1", "assistant pass")
+	doctor := s.login(t, "dr.test", "doctor pass")
+	nurse := s.login(t, "nurse.test", "nurse pass")
+	assistant := s.login(t, "assistant.test", "assistant pass")
+
+	var patient struct {
+		Code int `json:"code"`
+	}
+	s.mustPost(t, assistant, "/api/CreatePatient", map[string]interface{}{"first_name": "Karim", "last_name": "Saidi"}, &patient)
+	today := time.Now().Format("2006-01-02")
+
+	// Visits
+	var visit struct {
+		ID int64 `json:"id"`
+	}
+	s.mustPost(t, nurse, "/api/CreateVisit", map[string]interface{}{
+		"patient_code": patient.Code,
+		"visit_date":   today,
+		"doctor_name":  "dr.test",
+		"motif":        "Contrôle",
+	}, &visit)
+	if visit.ID <= 0 {
+		t.Fatalf("created visit id %d", visit.ID)
+	}
+
+	var visits struct {
+		Visits []struct {
+			ID    int64  `json:"id"`
+			Motif string `json:"motif"`
+		} `json:"visits"`
+	}
+	s.mustPost(t, nurse, "/api/GetVisitsForPatient", map[string]int{"patient_code": patient.Code}, &visits)
+	if len(visits.Visits) != 1 || visits.Visits[0].ID != visit.ID || visits.Visits[0].Motif != "Contrôle" {
+		t.Fatalf("visits of the patient: %+v", visits.Visits)
+	}
+
+	// Payments
+	var payment struct {
+		ID int64 `json:"id"`
+	}
+	s.mustPost(t, assistant, "/api/CreatePayment", map[string]interface{}{
+		"medical_act_id":     1,
+		"medical_act_name":   "GRATUIT",
+		"amount":             2000.0,
+		"user_id":            "dr.test",
+		"user_name":          "dr.test",
+		"patient_code":       patient.Code,
+		"patient_first_name": "Karim",
+		"patient_last_name":  "Saidi",
+		"payment_time":       time.Now().Format("2006-01-02 15:04:05"),
+	}, &payment)
+	if payment.ID <= 0 {
+		t.Fatalf("created payment id %d", payment.ID)
+	}
+
+	paymentsOfTheDay := func() []int64 {
+		t.Helper()
+		var reply struct {
+			Payments []struct {
+				ID int64 `json:"id"`
+			} `json:"payments"`
+		}
+		s.mustPost(t, doctor, "/api/GetPaymentsByUserAndDate", map[string]string{"user_name": "dr.test", "date": today}, &reply)
+		ids := []int64{}
+		for _, p := range reply.Payments {
+			ids = append(ids, p.ID)
+		}
+		return ids
+	}
+	if ids := paymentsOfTheDay(); len(ids) != 1 || ids[0] != payment.ID {
+		t.Fatalf("payments of the day: %v", ids)
+	}
+
+	var count struct {
+		Count int `json:"count"`
+	}
+	s.mustPost(t, assistant, "/api/CountPaymentsByPatientAndDate", map[string]interface{}{"patient_code": patient.Code, "date": today}, &count)
+	if count.Count != 1 {
+		t.Errorf("payments of the patient today: %d, want 1", count.Count)
+	}
+
+	// Nurses cannot delete either
+	if status := s.post(t, nurse, "/api/DeletePayment", map[string]int64{"id": payment.ID}, nil); status != http.StatusForbidden {
+		t.Errorf("nurse deleting a payment: status %d, want 403", status)
+	}
+	if status := s.post(t, nurse, "/api/DeleteVisit", map[string]int64{"id": visit.ID}, nil); status != http.StatusForbidden {
+		t.Errorf("nurse deleting a visit: status %d, want 403", status)
+	}
+
+	s.mustPost(t, doctor, "/api/DeletePayment", map[string]int64{"id": payment.ID}, nil)
+	if status := s.post(t, doctor, "/api/DeletePayment", map[string]int64{"id": payment.ID}, nil); status != http.StatusNotFound {
+		t.Errorf("deleting a payment twice: status %d, want 404", status)
+	}
+	if ids := paymentsOfTheDay(); len(ids) != 0 {
+		t.Errorf("deleted payment still listed: %v", ids)
+	}
+
+	s.mustPost(t, doctor, "/api/DeleteVisit", map[string]interface{}{"id": visit.ID, "patient_code": patient.Code}, nil)
+	s.mustPost(t, nurse, "/api/GetVisitsForPatient", map[string]int{"patient_code": patient.Code}, &visits)
+	if len(visits.Visits) != 0 {
+		t.Errorf("deleted visit still listed: %+v", visits.Visits)
+	}
+}
+
+// ClearAllVisits must keep the visits of deleted patients, or restoring them
+// would bring back a patient without its history
+func TestIntegrationClearAllVisitsKeepsDeletedPatients(t *testing.T) {
+	s := newTestServer(t)
+	s.addUser(t, "dr.test", "Médecin", "doctor pass")
+	s.addUser(t, "admin.test", "Administrateur", "admin pass")
+	doctor := s.login(t, "dr.test", "doctor pass")
+	admin := s.login(t, "admin.test", "admin pass")
+
+	codes := map[string]int{}
+	for _, name := range []string{"live", "deleted"} {
+		var patient struct {
+			Code int `json:"code"`
+		}
+		s.mustPost(t, doctor, "/api/CreatePatient", map[string]interface{}{"first_name": name, "last_name": "Patient"}, &patient)
+		s.mustPost(t, doctor, "/api/CreateVisit", map[string]interface{}{
+			"patient_code": patient.Code,
+			"visit_date":   time.Now().Format("2006-01-02"),
+			"doctor_name":  "dr.test",
+		}, nil)
+		codes[name] = patient.Code
+	}
+	s.mustPost(t, doctor, "/api/DeletePatient", map[string]int{"patient_code": codes["deleted"]}, nil)
+
+	var cleared struct {
+		Deleted int64 `json:"deleted"`
+	}
+	s.mustPost(t, admin, "/api/ClearAllVisits", map[string]string{}, &cleared)
+	if cleared.Deleted != 1 {
+		t.Errorf("cleared %d visits, want 1", cleared.Deleted)
+	}
+
+	s.mustPost(t, doctor, "/api/RestorePatient", map[string]int{"patient_code": codes["deleted"]}, nil)
+	var visits struct {
+		Visits []json.RawMessage `json:"visits"`
+	}
+	s.mustPost(t, doctor, "/api/GetVisitsForPatient", map[string]int{"patient_code": codes["deleted"]}, &visits)
+	if len(visits.Visits) != 1 {
+		t.Errorf("restored patient has %d visits, want 1", len(visits.Visits))
+	}
+}
+
+// Assistants create their users from templates, but a template must not let
+// them create an administrator
+func TestIntegrationCreateUserFromTemplateChecksTheRole(t *testing.T) {
+	s := newTestServer(t)
+	s.addUser(t, "assistant.test", "Assistant 1", "assistant pass")
+	assistant := s.login(t, "assistant.test", "assistant pass")
+
+	hash, err := middleware.HashPassword("template pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, role := range map[string]string{"tpl-admin": "Administrateur", "tpl-assistant": "Assistant 2"} {
+		if _, err := s.db.Exec(`INSERT INTO templates (id, role, password_hash, percentage) VALUES ($1, $2, $3, 0)`, id, role, hash); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	status := s.post(t, assistant, "/api/CreateUserFromTemplate", map[string]string{"template_id": "tpl-admin", "user_name": "Mallory Admin", "user_id": "mallory"}, nil)
+	if status != http.StatusForbidden {
+		t.Errorf("assistant using an administrator template: status %d, want 403", status)
+	}
+	var exists bool
+	if err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE id = 'mallory')`).Scan(&exists); err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Error("user created from a refused template")
+	}
+
+	s.mustPost(t, assistant, "/api/CreateUserFromTemplate", map[string]string{"template_id": "tpl-assistant", "user_name": "Nadia Assistante", "user_id": "nadia"}, nil)
+}
+
+// Changing a row that does not exist is a 404, leaving no audit entry and
+// sending no event
+func TestIntegrationMissingRowsAre404(t *testing.T) {
+	s := newTestServer(t)
+	s.addUser(t, "dr.test", "Médecin", "doctor pass")
+	doctor := s.login(t, "dr.test", "doctor pass")
+
+	var patient struct {
+		Code int `json:"code"`
+	}
+	s.mustPost(t, doctor, "/api/CreatePatient", map[string]interface{}{"first_name": "Yacine", "last_name": "Brahimi"}, &patient)
+
+	const missing = 999999
+	calls := []struct {
+		route string
+		body  map[string]interface{}
+	}{
+		{"/api/UpdateVisit", map[string]interface{}{"id": missing, "patient_code": patient.Code, "visit_date": "2026-01-05", "doctor_name": "dr.test"}},
+		{"/api/DeleteVisit", map[string]interface{}{"id": missing, "patient_code": patient.Code}},
+		{"/api/UpdateOrdonnance", map[string]interface{}{"id": missing, "patient_code": patient.Code, "content1": "Collyre"}},
+		{"/api/DeleteOrdonnance", map[string]interface{}{"id": missing, "patient_code": patient.Code}},
+		{"/api/UpdatePayment", map[string]interface{}{"id": missing, "medical_act_id": 1, "amount": 1000.0, "patient_code": patient.Code, "payment_time": "2026-01-05 10:00:00"}},
+		{"/api/DeletePayment", map[string]interface{}{"id": missing}},
+	}
+	for _, call := range calls {
+		if status := s.post(t, doctor, call.route, call.body, nil); status != http.StatusNotFound {
+			t.Errorf("%s of a missing row: status %d, want 404", call.route, status)
+		}
+	}
+
+	var audited int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM audit_log WHERE record_id = $1`, fmt.Sprint(missing)).Scan(&audited); err != nil {
+		t.Fatal(err)
+	}
+	if audited != 0 {
+		t.Errorf("%d audit entries for rows that do not exist", audited)
+	}
+}
+
+func TestIntegrationDeletedPatientsRecordsCannotChange(t *testing.T) {
+	s := newTestServer(t)
+	s.addUser(t, "dr.test", "Médecin", "doctor pass")
+	doctor := s.login(t, "dr.test", "doctor pass")
+
+	var patient, visit, payment, kept, deleted struct {
+		Code int   `json:"code"`
+		ID   int64 `json:"id"`
+	}
+	s.mustPost(t, doctor, "/api/CreatePatient", map[string]interface{}{"first_name": "Nadia", "last_name": "Mansouri"}, &patient)
+	s.mustPost(t, doctor, "/api/CreateVisit", map[string]interface{}{"patient_code": patient.Code, "visit_date": "2026-01-05", "doctor_name": "dr.test"}, &visit)
+	s.mustPost(t, doctor, "/api/CreatePayment", map[string]interface{}{
+		"medical_act_id": 1, "medical_act_name": "GRATUIT", "amount": 1000.0, "user_id": "dr.test", "user_name": "dr.test",
+		"patient_code": patient.Code, "payment_time": "2026-01-05 10:00:00",
+	}, &payment)
+	s.mustPost(t, doctor, "/api/CreateOrdonnance", map[string]interface{}{"patient_code": patient.Code, "content1": "Collyre"}, &kept)
+	s.mustPost(t, doctor, "/api/CreateOrdonnance", map[string]interface{}{"patient_code": patient.Code, "content1": "Lunettes"}, &deleted)
+
+	ordonnances := func() []int64 {
+		t.Helper()
+		var reply struct {
+			Ordonnances []struct {
+				ID int64 `json:"id"`
+			} `json:"ordonnances"`
+		}
+		s.mustPost(t, doctor, "/api/GetOrdonnancesForPatient", map[string]int{"patient_code": patient.Code}, &reply)
+		ids := []int64{}
+		for _, o := range reply.Ordonnances {
+			ids = append(ids, o.ID)
+		}
+		return ids
+	}
+
+	// Ordonnances are soft-deleted like visits and payments
+	s.mustPost(t, doctor, "/api/DeleteOrdonnance", map[string]interface{}{"id": deleted.ID, "patient_code": patient.Code}, nil)
+	if status := s.post(t, doctor, "/api/DeleteOrdonnance", map[string]interface{}{"id": deleted.ID, "patient_code": patient.Code}, nil); status != http.StatusNotFound {
+		t.Errorf("deleting an ordonnance twice: status %d, want 404", status)
+	}
+	var stored int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM ordonnances WHERE id = $1`, deleted.ID).Scan(&stored); err != nil || stored != 1 {
+		t.Errorf("deleted ordonnance removed from the table: %d rows, %v", stored, err)
+	}
+
+	s.mustPost(t, doctor, "/api/DeletePatient", map[string]int{"patient_code": patient.Code}, nil)
+	calls := []struct {
+		route string
+		body  map[string]interface{}
+	}{
+		{"/api/UpdateVisit", map[string]interface{}{"id": visit.ID, "patient_code": patient.Code, "visit_date": "2026-01-05", "doctor_name": "dr.test"}},
+		{"/api/DeleteVisit", map[string]interface{}{"id": visit.ID, "patient_code": patient.Code}},
+		{"/api/UpdateOrdonnance", map[string]interface{}{"id": kept.ID, "patient_code": patient.Code, "content1": "Collyre"}},
+		{"/api/DeleteOrdonnance", map[string]interface{}{"id": kept.ID, "patient_code": patient.Code}},
+		{"/api/UpdatePayment", map[string]interface{}{"id": payment.ID, "medical_act_id": 1, "amount": 1000.0, "patient_code": patient.Code, "payment_time": "2026-01-05 10:00:00"}},
+		{"/api/DeletePayment", map[string]interface{}{"id": payment.ID}},
+	}
+	for _, call := range calls {
+		if status := s.post(t, doctor, call.route, call.body, nil); status != http.StatusNotFound {
+			t.Errorf("%s of a deleted patient's record: status %d, want 404", call.route, status)
+		}
+	}
+
+	// Restoring the patient brings back what was deleted with it only
+	s.mustPost(t, doctor, "/api/RestorePatient", map[string]int{"patient_code": patient.Code}, nil)
+	if ids := ordonnances(); len(ids) != 1 || ids[0] != kept.ID {
+		t.Errorf("ordonnances after the restore: %v, want [%d]", ids, kept.ID)
+	}
+	s.mustPost(t, doctor, "/api/DeleteVisit", map[string]interface{}{"id": visit.ID, "patient_code": patient.Code}, nil)
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"medicore/internal/models"
+	"medicore/internal/repository"
+	"medicore/internal/services"
+	"medicore/internal/validation"
+)
+
+// ordonnanceRequest is the body of CreateOrdonnance and UpdateOrdonnance
+type ordonnanceRequest struct{ models.Ordonnance }
+
+func (req *ordonnanceRequest) validate(v *validation.Validator) {
+	v.RequiredID("patient_code", int64(req.PatientCode))
+	v.Min("sequence", int64(req.Sequence), 0)
+	if req.DocumentDate != nil {
+		v.Date("document_date", *req.DocumentDate)
+	}
+}
+
+type createOrdonnanceRequest struct{ ordonnanceRequest }
+
+func (req *createOrdonnanceRequest) Validate(v *validation.Validator) {
+	req.validate(v)
+}
+
+type updateOrdonnanceRequest struct{ ordonnanceRequest }
+
+func (req *updateOrdonnanceRequest) Validate(v *validation.Validator) {
+	v.RequiredID("id", req.ID)
+	req.validate(v)
+}
+
+// ==================== ORDONNANCE HANDLERS ====================
+
+func (h *RESTHandler) GetOrdonnancesForPatient(w http.ResponseWriter, r *http.Request) {
+	var req patientCodeRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	ordonnances, err := h.ordonnances.GetForPatient(req.PatientCode)
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	respondJSON(w, map[string]interface{}{"ordonnances": ordonnances})
+}
+
+func (h *RESTHandler) CreateOrdonnance(w http.ResponseWriter, r *http.Request) {
+	var req createOrdonnanceRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+	id, err := h.ordonnances.Create(&req.Ordonnance)
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	h.recordAudit(r, services.AuditCreate, "ordonnances", id, nil, h.snapshot("ordonnances", id))
+	h.hub.BroadcastOrdonnanceEvent(EventOrdonnanceCreated, PatientRecordPayload{ID: id, PatientCode: req.PatientCode})
+	respondJSON(w, map[string]interface{}{"id": id})
+}
+
+func (h *RESTHandler) UpdateOrdonnance(w http.ResponseWriter, r *http.Request) {
+	var req updateOrdonnanceRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+	id := req.ID
+	oldValues := h.snapshot("ordonnances", id)
+	err := h.ordonnances.Update(&req.Ordonnance)
+	if errors.Is(err, repository.ErrNotFound) {
+		respondError(w, 404, "ordonnance not found")
+		return
+	}
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	h.recordAudit(r, services.AuditUpdate, "ordonnances", id, oldValues, h.snapshot("ordonnances", id))
+	h.hub.BroadcastOrdonnanceEvent(EventOrdonnanceUpdated, PatientRecordPayload{ID: id, PatientCode: req.PatientCode})
+	respondJSON(w, map[string]interface{}{})
+}
+
+func (h *RESTHandler) DeleteOrdonnance(w http.ResponseWriter, r *http.Request) {
+	var req patientRowRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+	id := req.ID
+	oldValues := h.snapshot("ordonnances", id)
+	err := h.ordonnances.Delete(id)
+	if errors.Is(err, repository.ErrNotFound) {
+		respondError(w, 404, "ordonnance not found")
+		return
+	}
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	h.recordAudit(r, services.AuditDelete, "ordonnances", id, oldValues, h.snapshot("ordonnances", id))
+	h.hub.BroadcastOrdonnanceEvent(EventOrdonnanceDeleted, PatientRecordPayload{ID: id, PatientCode: req.PatientCode})
+	respondJSON(w, map[string]interface{}{})
+}
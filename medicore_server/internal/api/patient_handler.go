@@ -0,0 +1,343 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"medicore/internal/models"
+	"medicore/internal/repository"
+	"medicore/internal/services"
+	"medicore/internal/validation"
+)
+
+// patientRequest is the body of CreatePatient, UpdatePatient and ImportPatient
+type patientRequest struct {
+	Code        int     `json:"code"`
+	Barcode     string  `json:"barcode"`
+	FirstName   string  `json:"first_name"`
+	LastName    string  `json:"last_name"`
+	Age         *int    `json:"age"`
+	DateOfBirth *string `json:"date_of_birth"`
+	Address     *string `json:"address"`
+	Phone       *string `json:"phone"`
+	OtherInfo   *string `json:"other_info"`
+}
+
+func (req *patientRequest) toModel() *models.Patient {
+	return &models.Patient{
+		Code:        req.Code,
+		Barcode:     req.Barcode,
+		FirstName:   req.FirstName,
+		LastName:    req.LastName,
+		Age:         req.Age,
+		DateOfBirth: req.DateOfBirth,
+		Address:     req.Address,
+		Phone:       req.Phone,
+		Notes:       req.OtherInfo,
+	}
+}
+
+func (req *patientRequest) validate(v *validation.Validator) {
+	v.Required("first_name", req.FirstName)
+	v.Required("last_name", req.LastName)
+	if req.Age != nil {
+		v.Range("age", int64(*req.Age), 0, 150)
+	}
+	if req.DateOfBirth != nil {
+		v.Date("date_of_birth", *req.DateOfBirth)
+	}
+}
+
+type createPatientRequest struct{ patientRequest }
+
+func (req *createPatientRequest) Validate(v *validation.Validator) {
+	v.Min("code", int64(req.Code), 0)
+	v.MaxLength("barcode", req.Barcode, 8)
+	req.validate(v)
+}
+
+type updatePatientRequest struct{ patientRequest }
+
+func (req *updatePatientRequest) Validate(v *validation.Validator) {
+	v.RequiredID("code", int64(req.Code))
+	req.validate(v)
+}
+
+// importPatientRequest only requires the code: legacy exports may lack
+// names or hold dates in other formats
+type importPatientRequest struct{ patientRequest }
+
+func (req *importPatientRequest) Validate(v *validation.Validator) {
+	v.RequiredID("code", int64(req.Code))
+}
+
+// patientCodeRequest is the body of requests addressing a single patient
+type patientCodeRequest struct {
+	PatientCode int `json:"patient_code"`
+}
+
+func (req *patientCodeRequest) Validate(v *validation.Validator) {
+	v.RequiredID("patient_code", int64(req.PatientCode))
+}
+
+// patientBarcodeRequest is the body of GetPatientByBarcode
+type patientBarcodeRequest struct {
+	Barcode string `json:"barcode"`
+}
+
+func (req *patientBarcodeRequest) Validate(v *validation.Validator) {
+	v.Required("barcode", req.Barcode)
+}
+
+// ==================== PATIENT HANDLERS ====================
+
+func (h *RESTHandler) GetAllPatients(w http.ResponseWriter, r *http.Request) {
+	patients, err := h.patients.GetAll()
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	respondJSON(w, map[string]interface{}{"patients": patients})
+}
+
+func (h *RESTHandler) GetPatientByCode(w http.ResponseWriter, r *http.Request) {
+	var req patientCodeRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	patient, err := h.patients.GetByCode(req.PatientCode)
+	if errors.Is(err, repository.ErrNotFound) {
+		respondJSON(w, map[string]interface{}{})
+		return
+	}
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	respondJSON(w, patient)
+}
+
+// GetPatientByBarcode returns the patient whose card was scanned
+func (h *RESTHandler) GetPatientByBarcode(w http.ResponseWriter, r *http.Request) {
+	var req patientBarcodeRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	patient, err := h.patients.GetByBarcode(strings.TrimSpace(req.Barcode))
+	if errors.Is(err, repository.ErrNotFound) {
+		respondJSON(w, map[string]interface{}{})
+		return
+	}
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	respondJSON(w, patient)
+}
+
+func (h *RESTHandler) SearchPatients(w http.ResponseWriter, r *http.Request) {
+	var req searchRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	patients, err := h.patients.Search(req.Query)
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	respondJSON(w, map[string]interface{}{"patients": patients})
+}
+
+func (h *RESTHandler) CreatePatient(w http.ResponseWriter, r *http.Request) {
+	var req createPatientRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+	patient := req.toModel()
+
+	err := repository.InTx(h.db, func(tx repository.DBTX) error {
+		patients := repository.NewPatientRepository(tx)
+
+		// Auto-generate code if not provided or 0 - NEVER reuse codes even after deletion
+		if patient.Code <= 0 {
+			code, err := patients.NextCode()
+			if err != nil {
+				return err
+			}
+			patient.Code = code
+		}
+		// Auto-generates the barcode if not provided
+		return patients.Create(patient)
+	})
+	if errors.Is(err, repository.ErrBarcodeTaken) {
+		respondError(w, 409, err.Error())
+		return
+	}
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	code := patient.Code
+
+	h.recordAudit(r, services.AuditCreate, "patients", code, nil, h.snapshot("patients", code))
+
+	// Broadcast SSE event for real-time sync
+	h.hub.BroadcastPatientEvent(EventPatientCreated, PatientPayload{
+		PatientCode: code,
+		FirstName:   patient.FirstName,
+		LastName:    patient.LastName,
+	})
+
+	respondJSON(w, map[string]interface{}{"code": code, "id": code})
+}
+
+func (h *RESTHandler) UpdatePatient(w http.ResponseWriter, r *http.Request) {
+	var req updatePatientRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+	code := req.Code
+
+	oldValues := h.snapshot("patients", code)
+
+	err := h.patients.Update(req.toModel())
+	if errors.Is(err, repository.ErrNotFound) {
+		respondError(w, 404, "patient not found")
+		return
+	}
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+
+	h.recordAudit(r, services.AuditUpdate, "patients", code, oldValues, h.snapshot("patients", code))
+
+	// Broadcast SSE event for real-time sync
+	h.hub.BroadcastPatientEvent(EventPatientUpdated, PatientPayload{PatientCode: code})
+
+	respondJSON(w, map[string]interface{}{})
+}
+
+// DeletePatient soft-deletes a patient with all of its related data. It can
+// be restored with RestorePatient until the retention period expires.
+func (h *RESTHandler) DeletePatient(w http.ResponseWriter, r *http.Request) {
+	var req patientCodeRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+	code := req.PatientCode
+
+	// Keep the patient and the dependent records for the audit trail
+	oldValues := h.snapshot("patients", code)
+	oldDependents := map[string]json.RawMessage{}
+	for _, table := range []string{"visits", "payments", "ordonnances", "surgery_plans"} {
+		oldDependents[table] = h.snapshotWhere(table, "patient_code = $1 AND deleted_at IS NULL", code)
+	}
+
+	err := repository.InTx(h.db, func(tx repository.DBTX) error {
+		return repository.NewPatientRepository(tx).Delete(code)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		respondError(w, 404, "patient not found")
+		return
+	}
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+
+	log.Printf("✓ Patient %d and all related data deleted", code)
+
+	h.recordAudit(r, services.AuditDelete, "patients", code, oldValues, nil)
+	for table, rows := range oldDependents {
+		if len(rows) > 0 && string(rows) != "[]" {
+			h.recordAudit(r, services.AuditDelete, table, fmt.Sprintf("patient:%d", code), rows, nil)
+		}
+	}
+
+	// Broadcast SSE event for real-time sync
+	h.hub.BroadcastPatientEvent(EventPatientDeleted, PatientPayload{PatientCode: code})
+
+	respondJSON(w, map[string]interface{}{})
+}
+
+// RestorePatient brings back a deleted patient with the data deleted along
+// with it
+func (h *RESTHandler) RestorePatient(w http.ResponseWriter, r *http.Request) {
+	var req patientCodeRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+	code := req.PatientCode
+
+	oldValues := h.snapshot("patients", code)
+
+	err := repository.InTx(h.db, func(tx repository.DBTX) error {
+		return repository.NewPatientRepository(tx).Restore(code)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		respondError(w, 404, "no deleted patient with this code")
+		return
+	}
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+
+	log.Printf("✓ Patient %d and its related data restored", code)
+
+	h.recordAudit(r, services.AuditRestore, "patients", code, oldValues, h.snapshot("patients", code))
+
+	// Broadcast SSE event for real-time sync
+	h.hub.BroadcastPatientEvent(EventPatientRestored, PatientPayload{PatientCode: code})
+
+	respondJSON(w, map[string]interface{}{})
+}
+
+// ImportPatient inserts or overwrites a patient coming from a legacy export
+func (h *RESTHandler) ImportPatient(w http.ResponseWriter, r *http.Request) {
+	var req importPatientRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+	patient := req.toModel()
+	patient.Barcode = ""
+	code := patient.Code
+
+	oldValues := h.snapshot("patients", code)
+
+	if err := h.patients.Import(patient); err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+
+	action, eventType := services.AuditUpdate, EventPatientUpdated
+	if oldValues == nil {
+		action, eventType = services.AuditCreate, EventPatientCreated
+	}
+	h.recordAudit(r, action, "patients", code, oldValues, h.snapshot("patients", code))
+
+	// Broadcast SSE event for real-time sync
+	h.hub.BroadcastPatientEvent(eventType, PatientPayload{
+		PatientCode: code,
+		FirstName:   patient.FirstName,
+		LastName:    patient.LastName,
+	})
+
+	respondJSON(w, map[string]interface{}{"code": code})
+}
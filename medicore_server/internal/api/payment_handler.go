@@ -0,0 +1,320 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"medicore/internal/models"
+	"medicore/internal/repository"
+	"medicore/internal/services"
+	"medicore/internal/validation"
+)
+
+// paymentRequest is the body of CreatePayment and UpdatePayment. The amount
+// may arrive as a double from the Dart clients.
+type paymentRequest struct {
+	ID               int64   `json:"id"`
+	MedicalActID     int     `json:"medical_act_id"`
+	MedicalActName   *string `json:"medical_act_name"`
+	Notes            string  `json:"notes"`
+	Amount           float64 `json:"amount"`
+	UserID           string  `json:"user_id"`
+	UserName         string  `json:"user_name"`
+	PatientCode      int     `json:"patient_code"`
+	PatientFirstName string  `json:"patient_first_name"`
+	PatientLastName  string  `json:"patient_last_name"`
+	PaymentTime      string  `json:"payment_time"`
+	PaymentDate      string  `json:"payment_date"`
+}
+
+func (req *paymentRequest) toModel() *models.Payment {
+	p := &models.Payment{
+		ID:               req.ID,
+		MedicalActID:     req.MedicalActID,
+		Amount:           int(req.Amount),
+		UserID:           req.UserID,
+		UserName:         req.UserName,
+		PatientCode:      req.PatientCode,
+		PatientFirstName: req.PatientFirstName,
+		PatientLastName:  req.PatientLastName,
+		PaymentTime:      req.PaymentTime,
+	}
+	if req.MedicalActName != nil {
+		p.MedicalActName = *req.MedicalActName
+	}
+	return p
+}
+
+func (req *paymentRequest) validate(v *validation.Validator) {
+	v.RequiredID("patient_code", int64(req.PatientCode))
+	v.Min("medical_act_id", int64(req.MedicalActID), 0)
+	v.Check(req.Amount >= 0, "amount", "must be at least 0")
+	v.Date("payment_time", req.PaymentTime)
+	v.Date("payment_date", req.PaymentDate)
+}
+
+type createPaymentRequest struct{ paymentRequest }
+
+func (req *createPaymentRequest) Validate(v *validation.Validator) {
+	req.validate(v)
+}
+
+type updatePaymentRequest struct{ paymentRequest }
+
+func (req *updatePaymentRequest) Validate(v *validation.Validator) {
+	v.RequiredID("id", req.ID)
+	req.validate(v)
+}
+
+// patientDateRequest is the body of requests addressing a patient's
+// payments on a day (YYYY-MM-DD)
+type patientDateRequest struct {
+	PatientCode int    `json:"patient_code"`
+	Date        string `json:"date"`
+}
+
+func (req *patientDateRequest) Validate(v *validation.Validator) {
+	v.RequiredID("patient_code", int64(req.PatientCode))
+	v.Required("date", req.Date)
+	v.Date("date", req.Date)
+}
+
+// userNameRequest is the body of requests addressing a user's payments
+type userNameRequest struct {
+	UserName string `json:"user_name"`
+}
+
+func (req *userNameRequest) Validate(v *validation.Validator) {
+	v.Required("user_name", req.UserName)
+}
+
+// userDateRequest is the body of requests addressing a user's payments on
+// a day (YYYY-MM-DD)
+type userDateRequest struct {
+	UserName string `json:"user_name"`
+	Date     string `json:"date"`
+}
+
+func (req *userDateRequest) Validate(v *validation.Validator) {
+	v.Required("user_name", req.UserName)
+	v.Required("date", req.Date)
+	v.Date("date", req.Date)
+}
+
+// ==================== PAYMENT HANDLERS ====================
+
+func (h *RESTHandler) GetPaymentsForPatient(w http.ResponseWriter, r *http.Request) {
+	var req patientCodeRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	payments, err := h.payments.GetForPatient(req.PatientCode)
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	respondJSON(w, map[string]interface{}{"payments": payments})
+}
+
+func (h *RESTHandler) GetPaymentsForVisit(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		VisitID int64 `json:"visit_id"`
+	}
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	// Note: visit_id is not in the new schema, so this returns empty for now
+	// Future: could be reimplemented to use patient_code + date matching
+	respondJSON(w, map[string]interface{}{"payments": []models.Payment{}})
+}
+
+func (h *RESTHandler) GetPaymentsByUserAndDate(w http.ResponseWriter, r *http.Request) {
+	var req userDateRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	payments, err := h.payments.GetByUserAndDate(req.UserName, req.Date)
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	respondJSON(w, map[string]interface{}{"payments": payments})
+}
+
+func (h *RESTHandler) CreatePayment(w http.ResponseWriter, r *http.Request) {
+	var req createPaymentRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	payment := req.toModel()
+	if req.MedicalActName == nil {
+		payment.MedicalActName = req.Notes // fallback to notes
+	}
+	if payment.PaymentTime == "" {
+		payment.PaymentTime = req.PaymentDate
+	}
+	if payment.PaymentTime == "" {
+		payment.PaymentTime = time.Now().Format("2006-01-02 15:04:05")
+	}
+
+	id, err := h.payments.Create(payment)
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	h.recordAudit(r, services.AuditCreate, "payments", id, nil, h.snapshot("payments", id))
+
+	// Broadcast SSE event for real-time sync
+	h.hub.BroadcastPaymentEvent(EventPaymentCreated, PaymentPayload{
+		ID:          id,
+		PatientCode: payment.PatientCode,
+		Amount:      payment.Amount,
+		UserName:    payment.UserName,
+	})
+
+	respondJSON(w, map[string]interface{}{"id": id})
+}
+
+func (h *RESTHandler) UpdatePayment(w http.ResponseWriter, r *http.Request) {
+	var req updatePaymentRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+	id := req.ID
+
+	oldValues := h.snapshot("payments", id)
+
+	err := h.payments.Update(req.toModel())
+	if errors.Is(err, repository.ErrNotFound) {
+		respondError(w, 404, "payment not found")
+		return
+	}
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+
+	h.recordAudit(r, services.AuditUpdate, "payments", id, oldValues, h.snapshot("payments", id))
+
+	// Broadcast SSE event for real-time sync
+	h.hub.BroadcastPaymentEvent(EventPaymentUpdated, PaymentPayload{ID: id, PatientCode: req.PatientCode})
+
+	respondJSON(w, map[string]interface{}{})
+}
+
+func (h *RESTHandler) DeletePayment(w http.ResponseWriter, r *http.Request) {
+	var req idRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+	id := req.ID
+	oldValues := h.snapshot("payments", id)
+
+	// Soft delete to preserve accounting integrity
+	err := h.payments.Delete(id)
+	if errors.Is(err, repository.ErrNotFound) {
+		respondError(w, 404, "payment not found")
+		return
+	}
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	h.recordAudit(r, services.AuditDelete, "payments", id, oldValues, h.snapshot("payments", id))
+
+	// Broadcast SSE event for real-time sync
+	h.hub.BroadcastPaymentEvent(EventPaymentDeleted, PaymentPayload{ID: id})
+
+	respondJSON(w, map[string]interface{}{})
+}
+
+// ==================== ADDITIONAL PAYMENT HANDLERS ====================
+
+func (h *RESTHandler) GetPaymentById(w http.ResponseWriter, r *http.Request) {
+	var req idRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	payment, err := h.payments.GetByID(req.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		respondJSON(w, map[string]interface{}{})
+		return
+	}
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	respondJSON(w, payment)
+}
+
+func (h *RESTHandler) GetAllPaymentsByUser(w http.ResponseWriter, r *http.Request) {
+	var req userNameRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	payments, err := h.payments.GetAllByUser(req.UserName)
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	respondJSON(w, map[string]interface{}{"payments": payments})
+}
+
+func (h *RESTHandler) DeletePaymentsByPatientAndDate(w http.ResponseWriter, r *http.Request) {
+	var req patientDateRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	// Remember which payments are about to be deleted for the audit trail
+	ids, _ := h.payments.IDsByPatientAndDate(req.PatientCode, req.Date)
+	oldValues := map[int64]json.RawMessage{}
+	for _, id := range ids {
+		oldValues[id] = h.snapshot("payments", id)
+	}
+
+	count, err := h.payments.DeleteByPatientAndDate(req.PatientCode, req.Date)
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+
+	for _, id := range ids {
+		h.recordAudit(r, services.AuditDelete, "payments", id, oldValues[id], h.snapshot("payments", id))
+	}
+
+	respondJSON(w, map[string]interface{}{"deleted": count})
+}
+
+func (h *RESTHandler) CountPaymentsByPatientAndDate(w http.ResponseWriter, r *http.Request) {
+	var req patientDateRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	count, _ := h.payments.CountByPatientAndDate(req.PatientCode, req.Date)
+	respondJSON(w, map[string]interface{}{"count": count})
+}
+
+func (h *RESTHandler) GetMaxPaymentId(w http.ResponseWriter, r *http.Request) {
+	maxID, _ := h.payments.MaxID()
+	respondJSON(w, map[string]interface{}{"max_id": maxID})
+}
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"sort"
+
+	"medicore/internal/middleware"
+)
+
+// Role groups used by the permission table. Administrators are allowed on
+// every route, so they are never listed explicitly.
+var (
+	adminOnly      = []string{}
+	allStaff       = []string{middleware.RoleDoctor, middleware.RoleNurse, middleware.RoleAssistant}
+	doctors        = []string{middleware.RoleDoctor}
+	doctorsNurses  = []string{middleware.RoleDoctor, middleware.RoleNurse}
+	doctorsAssists = []string{middleware.RoleDoctor, middleware.RoleAssistant}
+	assistants     = []string{middleware.RoleAssistant}
+)
+
+// routePermissions lists the role categories allowed to call each route
+// registered in SetupRoutes and SetupSSERoutes. Routes missing from this table are admin only.
+var routePermissions = map[string][]string{
+	// Users
+	"/api/GetAllUsers":       allStaff,
+	"/api/GetUserById":       allStaff,
+	"/api/GetUserByUsername": allStaff,
+	"/api/CreateUser":        adminOnly,
+	"/api/UpdateUser":        adminOnly,
+	"/api/DeleteUser":        adminOnly,
+	"/api/GetTemplateUsers":  allStaff,
+	"/api/GetPermanentUsers": allStaff,
+
+	// User templates
+	"/api/GetAllUserTemplates":    adminOnly,
+	"/api/GetUserTemplateById":    adminOnly,
+	"/api/CreateUserTemplate":     adminOnly,
+	"/api/UpdateUserTemplate":     adminOnly,
+	"/api/DeleteUserTemplate":     adminOnly,
+	"/api/CreateUserFromTemplate": assistants,
+
+	// Rooms
+	"/api/GetAllRooms": allStaff,
+	"/api/GetRoomById": allStaff,
+	"/api/CreateRoom":  adminOnly,
+	"/api/UpdateRoom":  adminOnly,
+	"/api/DeleteRoom":  adminOnly,
+
+	// Patients
+	"/api/GetAllPatients":      allStaff,
+	"/api/GetPatientByCode":    allStaff,
+	"/api/GetPatientByBarcode": allStaff,
+	"/api/SearchPatients":      allStaff,
+	"/api/CreatePatient":       allStaff,
+	"/api/UpdatePatient":       allStaff,
+	"/api/DeletePatient":       doctors,
+	"/api/RestorePatient":      doctors,
+	"/api/ImportPatient":       adminOnly,
+
+	// Messages
+	"/api/GetMessagesByRoom":     allStaff,
+	"/api/GetMessageById":        allStaff,
+	"/api/CreateMessage":         allStaff,
+	"/api/DeleteMessage":         allStaff,
+	"/api/MarkMessageAsRead":     allStaff,
+	"/api/MarkAllMessagesAsRead": allStaff,
+
+	// Message templates
+	"/api/GetAllMessageTemplates":  allStaff,
+	"/api/GetMessageTemplateById":  allStaff,
+	"/api/CreateMessageTemplate":   doctors,
+	"/api/UpdateMessageTemplate":   doctors,
+	"/api/DeleteMessageTemplate":   doctors,
+	"/api/ReorderMessageTemplates": doctors,
+
+	// Waiting queue
+	"/api/GetWaitingPatientsByRoom":   allStaff,
+	"/api/GetWaitingPatientById":      allStaff,
+	"/api/AddWaitingPatient":          allStaff,
+	"/api/UpdateWaitingPatient":       allStaff,
+	"/api/RemoveWaitingPatient":       allStaff,
+	"/api/RemoveWaitingPatientByCode": allStaff,
+	"/api/MarkDilatationsAsNotified":  allStaff,
+
+	// Medical acts
+	"/api/GetAllMedicalActs":  allStaff,
+	"/api/GetMedicalActById":  allStaff,
+	"/api/CreateMedicalAct":   doctors,
+	"/api/UpdateMedicalAct":   doctors,
+	"/api/DeleteMedicalAct":   doctors,
+	"/api/ReorderMedicalActs": doctors,
+
+	// Visits
+	"/api/GetVisitsForPatient": allStaff,
+	"/api/GetVisitById":        allStaff,
+	"/api/GetTotalVisitCount":  allStaff,
+	"/api/CreateVisit":         doctorsNurses,
+	"/api/UpdateVisit":         doctorsNurses,
+	"/api/DeleteVisit":         doctors,
+	"/api/ClearAllVisits":      adminOnly,
+	"/api/InsertVisits":        adminOnly,
+
+	// Ordonnances
+	"/api/GetOrdonnancesForPatient": allStaff,
+	"/api/CreateOrdonnance":         doctorsAssists,
+	"/api/UpdateOrdonnance":         doctorsAssists,
+	"/api/DeleteOrdonnance":         doctors,
+
+	// Payments
+	"/api/GetPaymentsForPatient":          doctorsAssists,
+	"/api/GetPaymentsByPatient":           doctorsAssists,
+	"/api/GetPaymentsForVisit":            doctorsAssists,
+	"/api/GetPaymentsByUserAndDate":       doctorsAssists,
+	"/api/GetPaymentById":                 doctorsAssists,
+	"/api/GetAllPaymentsByUser":           doctorsAssists,
+	"/api/CountPaymentsByPatientAndDate":  doctorsAssists,
+	"/api/GetMaxPaymentId":                doctorsAssists,
+	"/api/CreatePayment":                  doctorsAssists,
+	"/api/UpdatePayment":                  doctorsAssists,
+	"/api/DeletePayment":                  doctors,
+	"/api/DeletePaymentsByPatientAndDate": doctors,
+
+	// Medications
+	"/api/GetAllMedications":        allStaff,
+	"/api/SearchMedications":        allStaff,
+	"/api/GetMedicationById":        allStaff,
+	"/api/GetMedicationCount":       allStaff,
+	"/api/IncrementMedicationUsage": doctorsAssists,
+	"/api/SetMedicationUsageCount":  doctors,
+	"/api/AddMedication":            doctors,
+	"/api/UpdateMedication":         doctors,
+	"/api/DeleteMedication":         doctors,
+
+	// Nurse preferences
+	"/api/GetNurseRoomPreferences":   allStaff,
+	"/api/SaveNurseRoomPreferences":  allStaff,
+	"/api/ClearNurseRoomPreferences": allStaff,
+	"/api/GetActiveNurses":           allStaff,
+	"/api/MarkNurseActive":           allStaff,
+	"/api/MarkNurseInactive":         allStaff,
+
+	// Presence
+	"/api/GetPresence": allStaff,
+
+	// Delta sync
+	"/api/GetChanges": allStaff,
+
+	// Real-time events (SetupSSERoutes)
+	"/api/events":           allStaff,
+	"/api/events/subscribe": allStaff,
+	"/api/events/ws":        allStaff,
+	"/api/events/schema":    allStaff,
+	"/api/events/metrics":   adminOnly,
+
+	// Templates CR
+	"/api/GetAllTemplatesCR":        allStaff,
+	"/api/IncrementTemplateCRUsage": doctorsAssists,
+
+	// Appointments
+	"/api/GetAppointmentsForDate":  allStaff,
+	"/api/GetAllAppointments":      allStaff,
+	"/api/CreateAppointment":       allStaff,
+	"/api/UpdateAppointmentDate":   allStaff,
+	"/api/MarkAppointmentAsAdded":  allStaff,
+	"/api/DeleteAppointment":       doctorsAssists,
+	"/api/CleanupPastAppointments": allStaff,
+
+	// Surgery plans
+	"/api/GetSurgeryPlansForDate": allStaff,
+	"/api/GetAllSurgeryPlans":     allStaff,
+	"/api/CreateSurgeryPlan":      doctorsAssists,
+	"/api/UpdateSurgeryPlan":      doctorsAssists,
+	"/api/RescheduleSurgery":      doctorsAssists,
+	"/api/DeleteSurgeryPlan":      doctors,
+
+	// Administration
+	"/api/GetPermissionMatrix": adminOnly,
+	"/api/GetAuditLog":         adminOnly,
+
+	// Backups
+	"/api/GetBackups":      adminOnly,
+	"/api/CreateBackup":    adminOnly,
+	"/api/DownloadBackup":  adminOnly,
+	"/api/VerifyBackup":    adminOnly,
+	"/api/PushBackups":     adminOnly,
+	"/api/RestoreBackup":   adminOnly,
+	"/api/RollbackRestore": adminOnly,
+}
+
+// allowedRoles returns the role categories allowed on a route
+func allowedRoles(route string) ([]string, bool) {
+	roles, ok := routePermissions[route]
+	return roles, ok
+}
+
+// CanAccess reports whether a stored role name may call a route
+func CanAccess(route, role string) bool {
+	roles, _ := allowedRoles(route)
+	return middleware.HasRole(role, roles...)
+}
+
+// authorize wraps a handler so it only runs for roles allowed on the route
+func authorize(route string, handler http.HandlerFunc) http.HandlerFunc {
+	if _, ok := allowedRoles(route); !ok {
+		log.Printf("⚠️ No permission entry for %s, restricting it to administrators", route)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "OPTIONS" && !CanAccess(route, middleware.GetUserRole(r)) {
+			respondError(w, http.StatusForbidden, "insufficient permissions for "+route)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// GetPermissionMatrix returns the permission table, one entry per route
+func (h *RESTHandler) GetPermissionMatrix(w http.ResponseWriter, r *http.Request) {
+	routes := make([]string, 0, len(routePermissions))
+	for route := range routePermissions {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+
+	matrix := make([]map[string]interface{}, 0, len(routes))
+	for _, route := range routes {
+		roles := append([]string{middleware.RoleAdmin}, routePermissions[route]...)
+		matrix = append(matrix, map[string]interface{}{
+			"route": route,
+			"roles": roles,
+		})
+	}
+
+	respondJSON(w, map[string]interface{}{
+		"roles":  []string{middleware.RoleAdmin, middleware.RoleDoctor, middleware.RoleNurse, middleware.RoleAssistant},
+		"routes": matrix,
+	})
+}
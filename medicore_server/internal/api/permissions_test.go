@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"medicore/internal/middleware"
+)
+
+// requestAs returns a request for route made by a user with a stored role
+// name, as the auth middleware would pass it on
+func requestAs(route, role string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, route, nil)
+	return r.WithContext(context.WithValue(r.Context(), middleware.UserRoleKey, role))
+}
+
+func TestAuthorize(t *testing.T) {
+	tests := []struct {
+		route string
+		role  string
+		want  int
+	}{
+		// Nurses cannot delete payments or visits
+		{"/api/DeletePayment", "Infirmière", http.StatusForbidden},
+		{"/api/DeletePayment", "Administrateur", http.StatusOK},
+		{"/api/DeletePayment", "Médecin", http.StatusOK},
+		{"/api/DeleteVisit", "Infirmière", http.StatusForbidden},
+		{"/api/DeleteVisit", "Administrateur", http.StatusOK},
+		{"/api/DeleteVisit", "Dr. Martin", http.StatusOK},
+		{"/api/DeletePaymentsByPatientAndDate", "Infirmier", http.StatusForbidden},
+
+		// Admin only routes
+		{"/api/ClearAllVisits", "Médecin", http.StatusForbidden},
+		{"/api/ClearAllVisits", "Administrateur", http.StatusOK},
+		{"/api/DeleteUser", "Assistant 1", http.StatusForbidden},
+		{"/api/RestoreBackup", "Médecin", http.StatusForbidden},
+		{"/api/CreateUserTemplate", "Assistant 1", http.StatusForbidden},
+
+		// Users from templates: assistants only, and the handler checks the
+		// template role with CanGrantRole
+		{"/api/CreateUserFromTemplate", "Assistant 1", http.StatusOK},
+		{"/api/CreateUserFromTemplate", "Infirmière", http.StatusForbidden},
+		{"/api/CreateUserFromTemplate", "Médecin", http.StatusForbidden},
+
+		// Staff routes
+		{"/api/CreateVisit", "Infirmière", http.StatusOK},
+		{"/api/CreatePayment", "Assistant 1", http.StatusOK},
+		{"/api/CreatePayment", "Infirmière", http.StatusForbidden},
+		{"/api/events/subscribe", "Infirmière", http.StatusOK},
+		{"/api/events/ws", "Assistant 1", http.StatusOK},
+		{"/api/events/metrics", "Médecin", http.StatusForbidden},
+		{"/api/events/metrics", "Administrateur", http.StatusOK},
+
+		// Unknown roles and routes missing from the table
+		{"/api/GetAllPatients", "", http.StatusForbidden},
+		{"/api/GetAllPatients", "Stagiaire", http.StatusForbidden},
+		{"/api/NotInTheTable", "Médecin", http.StatusForbidden},
+		{"/api/NotInTheTable", "Administrateur", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.route+" as "+tt.role, func(t *testing.T) {
+			handler := authorize(tt.route, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			w := httptest.NewRecorder()
+			handler(w, requestAs(tt.route, tt.role))
+			if w.Code != tt.want {
+				t.Errorf("got %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanGrantRole(t *testing.T) {
+	tests := []struct {
+		grantor string
+		role    string
+		want    bool
+	}{
+		{"Assistant 1", "Assistant 2", true},
+		{"Assistant 1", "Administrateur", false},
+		{"Assistant 1", "Médecin", false},
+		{"Assistant 1", "Infirmière", false},
+		{"Assistant 1", "Stagiaire", false},
+		{"Administrateur", "Administrateur", true},
+		{"Administrateur", "Dr. Martin", true},
+		{"Stagiaire", "Stagiaire", false},
+	}
+	for _, tt := range tests {
+		if got := middleware.CanGrantRole(tt.grantor, tt.role); got != tt.want {
+			t.Errorf("%s granting %s: got %v, want %v", tt.grantor, tt.role, got, tt.want)
+		}
+	}
+}
+
+func TestAuthorizeLetsPreflightThrough(t *testing.T) {
+	handler := authorize("/api/DeletePayment", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	r := httptest.NewRequest(http.MethodOptions, "/api/DeletePayment", nil)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("got %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+// Every route served with authorize must have an entry, or it silently
+// becomes admin only
+func TestEveryRouteHasPermissions(t *testing.T) {
+	mux := http.NewServeMux()
+	h := NewRESTHandler(nil, nil)
+	h.SetupRoutes(mux)
+	h.SetupSSERoutes(mux)
+
+	routes := []string{
+		"/api/events",
+		"/api/events/subscribe",
+		"/api/events/ws",
+		"/api/events/schema",
+		"/api/events/metrics",
+		"/api/GetPermissionMatrix",
+		"/api/RollbackRestore",
+	}
+	for _, route := range routes {
+		if _, pattern := mux.Handler(httptest.NewRequest(http.MethodPost, route, nil)); pattern != route {
+			t.Errorf("%s is not registered", route)
+		}
+		if _, ok := allowedRoles(route); !ok {
+			t.Errorf("%s has no permission entry", route)
+		}
+	}
+}
+
+func TestPermissionMatrixListsEventRoutes(t *testing.T) {
+	w := httptest.NewRecorder()
+	(&RESTHandler{}).GetPermissionMatrix(w, requestAs("/api/GetPermissionMatrix", "Administrateur"))
+
+	for _, route := range []string{"/api/events/subscribe", "/api/events/ws", "/api/events/schema"} {
+		if !CanAccess(route, "Infirmière") {
+			t.Errorf("nurses cannot use %s", route)
+		}
+		if !strings.Contains(w.Body.String(), `"route":"`+route+`"`) {
+			t.Errorf("%s missing from the permission matrix", route)
+		}
+	}
+}
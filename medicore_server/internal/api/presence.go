@@ -0,0 +1,183 @@
+package api
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"medicore/internal/middleware"
+)
+
+// presenceTimeout is how long a connection may go unseen before it is
+// dropped. SSE connections are seen on every successful write (pings go out
+// every 15 seconds), WebSocket ones on pongs and heartbeat commands.
+const presenceTimeout = 60 * time.Second
+
+// workstationOf names the machine an event stream comes from: the
+// "workstation" query param, the X-Workstation header, or the client IP
+func workstationOf(r *http.Request) string {
+	if workstation := r.URL.Query().Get("workstation"); workstation != "" {
+		return workstation
+	}
+	if workstation := r.Header.Get("X-Workstation"); workstation != "" {
+		return workstation
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// presence describes the connection for presence listings
+func (c *SSEClient) presence() ConnectionPresence {
+	rooms := c.Rooms()
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return ConnectionPresence{
+		ClientID:    c.ID,
+		Workstation: c.Workstation,
+		Rooms:       rooms,
+		ConnectedAt: c.connectedAt.UnixMilli(),
+		LastSeen:    c.lastSeen.UnixMilli(),
+	}
+}
+
+// seenSince reports whether the client was seen after t
+func (c *SSEClient) seenSince(t time.Time) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.lastSeen.After(t)
+}
+
+// Presence returns the users online, by user ID. Presence is derived from
+// the authenticated event stream connections: a user is online while at
+// least one of their connections to this instance is alive. It is not
+// shared between server instances.
+func (h *EventHub) Presence() []UserPresence {
+	return h.presenceOf("")
+}
+
+// presenceOf returns the presence of one user, or of every user when
+// userID is empty
+func (h *EventHub) presenceOf(userID string) []UserPresence {
+	h.mutex.RLock()
+	byUser := make(map[string]*UserPresence)
+	for _, client := range h.clients {
+		if client.UserID == "" || (userID != "" && client.UserID != userID) {
+			continue
+		}
+		user, ok := byUser[client.UserID]
+		if !ok {
+			user = &UserPresence{UserID: client.UserID, Role: client.Role}
+			byUser[client.UserID] = user
+		}
+		user.Connections = append(user.Connections, client.presence())
+	}
+	h.mutex.RUnlock()
+
+	users := make([]UserPresence, 0, len(byUser))
+	for _, user := range byUser {
+		sort.Slice(user.Connections, func(i, j int) bool {
+			return user.Connections[i].ConnectedAt < user.Connections[j].ConnectedAt
+		})
+		users = append(users, *user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].UserID < users[j].UserID })
+	return users
+}
+
+// connectionsOf counts the connections of a user. The caller holds the lock.
+func (h *EventHub) connectionsOf(userID string) int {
+	count := 0
+	for _, client := range h.clients {
+		if client.UserID == userID {
+			count++
+		}
+	}
+	return count
+}
+
+// left announces the presence of a client's user once the client is gone
+func (h *EventHub) left(client *SSEClient) {
+	h.mutex.RLock()
+	remaining := h.connectionsOf(client.UserID)
+	h.mutex.RUnlock()
+
+	if remaining == 0 {
+		h.announcePresence(EventUserOffline, client.UserID, client.Role)
+	} else {
+		h.announcePresence(EventPresenceUpdated, client.UserID, client.Role)
+	}
+}
+
+// announcePresence sends the current presence of a user to the clients of
+// this instance. Presence is per instance, so it is never relayed: another
+// instance would announce a user offline who is still connected to it.
+// Nurses also get the older nurse_active / nurse_inactive events.
+func (h *EventHub) announcePresence(eventType EventType, userID, role string) {
+	if userID == "" {
+		return
+	}
+
+	presence := UserPresence{UserID: userID, Role: role, Connections: []ConnectionPresence{}}
+	if users := h.presenceOf(userID); len(users) > 0 {
+		presence = users[0]
+	}
+	h.deliver(NewEvent(eventType, presence))
+
+	if middleware.RoleCategory(role) == middleware.RoleNurse {
+		switch eventType {
+		case EventUserOnline:
+			h.deliver(NewEvent(EventNurseActive, NursePayload{NurseID: userID}))
+		case EventUserOffline:
+			h.deliver(NewEvent(EventNurseInactive, NursePayload{NurseID: userID}))
+		}
+	}
+}
+
+// dropStale disconnects the clients not seen for presenceTimeout
+func (h *EventHub) dropStale() {
+	cutoff := time.Now().Add(-presenceTimeout)
+
+	var stale []*SSEClient
+	h.mutex.Lock()
+	for clientID, client := range h.clients {
+		if !client.seenSince(cutoff) {
+			close(client.Events)
+			delete(h.clients, clientID)
+			stale = append(stale, client)
+		}
+	}
+	h.mutex.Unlock()
+
+	for _, client := range stale {
+		log.Printf("⏰ SSE: Client %s of user %s timed out", client.ID, client.UserID)
+	}
+	h.announceLeft(stale)
+}
+
+// announceLeft announces the presence of the users of clients removed
+// together, once per user
+func (h *EventHub) announceLeft(clients []*SSEClient) {
+	announced := make(map[string]bool)
+	for _, client := range clients {
+		if !announced[client.UserID] {
+			announced[client.UserID] = true
+			h.left(client)
+		}
+	}
+}
+
+// ==================== PRESENCE HANDLERS ====================
+
+// GetPresence returns who is online, on which workstations and watching
+// which rooms
+func (h *RESTHandler) GetPresence(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, map[string]interface{}{
+		"users":           h.hub.Presence(),
+		"timeout_seconds": int(presenceTimeout.Seconds()),
+	})
+}
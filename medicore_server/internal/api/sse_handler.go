@@ -1,12 +1,20 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"sort"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"medicore/internal/middleware"
+	"medicore/internal/validation"
 )
 
 // EventType represents the type of real-time event
@@ -14,14 +22,16 @@ type EventType string
 
 const (
 	// Patient events
-	EventPatientCreated EventType = "patient_created"
-	EventPatientUpdated EventType = "patient_updated"
-	EventPatientDeleted EventType = "patient_deleted"
+	EventPatientCreated  EventType = "patient_created"
+	EventPatientUpdated  EventType = "patient_updated"
+	EventPatientDeleted  EventType = "patient_deleted"
+	EventPatientRestored EventType = "patient_restored"
 
 	// Message events
 	EventMessageCreated  EventType = "message_created"
 	EventMessageRead     EventType = "message_read"
 	EventMessagesCleared EventType = "messages_cleared"
+	EventMessageDeleted  EventType = "message_deleted"
 
 	// Waiting queue events
 	EventWaitingAdded    EventType = "waiting_added"
@@ -29,6 +39,8 @@ const (
 	EventWaitingRemoved  EventType = "waiting_removed"
 	EventDilatationAdded EventType = "dilatation_added"
 
+	EventDilatationsNotified EventType = "dilatations_notified"
+
 	// Payment events
 	EventPaymentCreated EventType = "payment_created"
 	EventPaymentUpdated EventType = "payment_updated"
@@ -76,113 +88,392 @@ const (
 	EventMedicationUpdated EventType = "medication_updated"
 	EventMedicationDeleted EventType = "medication_deleted"
 
+	// Template CR events
+	EventTemplateCRUpdated EventType = "template_cr_updated"
+
+	// Appointment events
+	EventAppointmentCreated  EventType = "appointment_created"
+	EventAppointmentUpdated  EventType = "appointment_updated"
+	EventAppointmentDeleted  EventType = "appointment_deleted"
+	EventAppointmentsCleaned EventType = "appointments_cleaned"
+
+	// Surgery plan events
+	EventSurgeryPlanCreated EventType = "surgery_plan_created"
+	EventSurgeryPlanUpdated EventType = "surgery_plan_updated"
+	EventSurgeryPlanDeleted EventType = "surgery_plan_deleted"
+
 	// Nurse preference events
 	EventNursePrefsUpdated EventType = "nurse_prefs_updated"
 	EventNurseActive       EventType = "nurse_active"
 	EventNurseInactive     EventType = "nurse_inactive"
 
+	// Presence events
+	EventUserOnline      EventType = "user_online"
+	EventUserOffline     EventType = "user_offline"
+	EventPresenceUpdated EventType = "presence_updated"
+
+	// Backup events
+	EventBackupVerificationFailed EventType = "backup_verification_failed"
+	EventRestoreStarted           EventType = "restore_started"
+	EventRestoreFinished          EventType = "restore_finished"
+
 	// System events
-	EventPing EventType = "ping"
+	EventConnected      EventType = "connected"
+	EventPing           EventType = "ping"
+	EventResyncRequired EventType = "resync_required"
+
+	// Replies to WebSocket commands
+	EventSubscribed   EventType = "subscribed"
+	EventCommandError EventType = "command_error"
+)
+
+const (
+	// eventJournalSize is how many past events are kept for Last-Event-ID replay
+	eventJournalSize = 1000
+	// clientEventBuffer is how many events may wait for a client before it
+	// is considered too slow and disconnected
+	clientEventBuffer = 50
+	// broadcastBuffer is how many events may wait for the hub
+	broadcastBuffer = 100
+	// pingInterval keeps idle connections alive and stale ones detected
+	pingInterval = 15 * time.Second
 )
 
 // Event represents a real-time event to broadcast
 type Event struct {
-	Type      EventType              `json:"type"`
-	RoomID    string                 `json:"room_id,omitempty"`
-	Data      map[string]interface{} `json:"data,omitempty"`
-	Timestamp int64                  `json:"timestamp"`
+	ID        int64       `json:"id,omitempty"`
+	Version   int         `json:"version"` // EventSchemaVersion of Data
+	Type      EventType   `json:"type"`
+	RoomID    string      `json:"room_id,omitempty"`
+	Data      interface{} `json:"data,omitempty"` // Payload type from the event catalog
+	Timestamp int64       `json:"timestamp"`
+
+	// Delivery targeting, never sent to clients
+	TargetUserID string   `json:"-"` // Only the connections of this user
+	TargetRoles  []string `json:"-"` // Only users of these role categories (admins always)
 }
 
 // SSEClient represents a connected SSE client
 type SSEClient struct {
-	ID      string
-	RoomIDs []string // Optional: rooms this client is interested in
-	Events  chan Event
-	Done    chan struct{}
+	ID          string
+	UserID      string     // Authenticated user owning the connection
+	Role        string     // Role name of that user
+	Workstation string     // Machine the connection comes from
+	Events      chan Event // Closed by the hub on eviction or when it stops, ending the stream
+
+	mutex       sync.RWMutex
+	roomIDs     map[string]bool // Rooms the client is subscribed to, empty for all rooms
+	ackedID     int64           // Last event acknowledged by the client (WebSocket only)
+	sentID      int64           // Last event written to the client
+	sentLag     time.Duration   // Time the last written event waited to be written
+	connectedAt time.Time
+	lastSeen    time.Time // Last sign of life, see presenceTimeout
 }
 
-// EventHub manages SSE connections and broadcasts events
+// Ack records the last event the client confirmed it processed
+func (c *SSEClient) Ack(eventID int64) {
+	c.mutex.Lock()
+	if eventID > c.ackedID {
+		c.ackedID = eventID
+	}
+	c.mutex.Unlock()
+}
+
+// Heartbeat records that the client is still alive
+func (c *SSEClient) Heartbeat() {
+	c.mutex.Lock()
+	c.lastSeen = time.Now()
+	c.mutex.Unlock()
+}
+
+// SetRooms replaces the rooms a client is subscribed to. No rooms means
+// every room.
+func (c *SSEClient) SetRooms(roomIDs []string) {
+	rooms := make(map[string]bool, len(roomIDs))
+	for _, roomID := range roomIDs {
+		if roomID != "" {
+			rooms[roomID] = true
+		}
+	}
+	c.mutex.Lock()
+	c.roomIDs = rooms
+	c.mutex.Unlock()
+}
+
+// Rooms returns the rooms a client is subscribed to
+func (c *SSEClient) Rooms() []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	rooms := make([]string, 0, len(c.roomIDs))
+	for roomID := range c.roomIDs {
+		rooms = append(rooms, roomID)
+	}
+	sort.Strings(rooms)
+	return rooms
+}
+
+// wants reports whether an event is meant for this client
+func (c *SSEClient) wants(event Event) bool {
+	if event.TargetUserID != "" && event.TargetUserID != c.UserID {
+		return false
+	}
+	if len(event.TargetRoles) > 0 && !middleware.HasRole(c.Role, event.TargetRoles...) {
+		return false
+	}
+	if event.RoomID != "" {
+		c.mutex.RLock()
+		defer c.mutex.RUnlock()
+		if len(c.roomIDs) > 0 && !c.roomIDs[event.RoomID] {
+			return false
+		}
+	}
+	return true
+}
+
+// EventHub manages SSE connections and broadcasts events. Every event but
+// pings gets an increasing ID and is kept in a bounded journal, so clients
+// reconnecting with Last-Event-ID can be sent what they missed.
 type EventHub struct {
 	clients    map[string]*SSEClient
-	register   chan *SSEClient
 	unregister chan string
 	broadcast  chan Event
 	mutex      sync.RWMutex
-}
 
-// Global event hub instance
-var Hub *EventHub
+	lastID  int64   // ID of the last journaled event
+	journal []Event // Last eventJournalSize events, oldest first
+
+	relay *EventRelay // Shares events with other server instances, if running
+
+	pingInterval time.Duration // pingInterval, shortened by tests
+
+	stop    context.CancelFunc // Stops the main loop, set by Start
+	stopped chan struct{}      // Closed once the main loop has returned
 
-func init() {
-	Hub = NewEventHub()
-	go Hub.Run()
+	eventsDropped  atomic.Int64 // Events lost because the broadcast channel was full
+	clientsEvicted atomic.Int64 // Clients disconnected for being too slow
+	resyncPending  atomic.Bool  // An event was lost: every client must resync
 }
 
+// errUnknownClient is returned for a client id that is not connected or
+// belongs to another user
+var errUnknownClient = errors.New("unknown event stream client")
+
 // NewEventHub creates a new event hub
 func NewEventHub() *EventHub {
 	return &EventHub{
 		clients:    make(map[string]*SSEClient),
-		register:   make(chan *SSEClient),
 		unregister: make(chan string),
-		broadcast:  make(chan Event, 100), // Buffered channel for events
+		broadcast:  make(chan Event, broadcastBuffer),
+		stopped:    make(chan struct{}),
+		// IDs start from the start time so they keep increasing across
+		// restarts, and IDs from before a restart are seen as too old
+		lastID:       time.Now().UnixMicro(),
+		pingInterval: pingInterval,
+	}
+}
+
+// Start runs the hub main loop in the background until ctx is cancelled
+// or Stop is called. A hub is started once.
+func (h *EventHub) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	h.mutex.Lock()
+	h.stop = cancel
+	h.mutex.Unlock()
+	go h.run(ctx)
+}
+
+// Stop stops the hub and waits until its clients are disconnected
+func (h *EventHub) Stop() {
+	h.mutex.RLock()
+	stop := h.stop
+	h.mutex.RUnlock()
+	if stop == nil {
+		return
 	}
+	stop()
+	<-h.stopped
 }
 
-// Run starts the event hub main loop
-func (h *EventHub) Run() {
+// run is the hub main loop
+func (h *EventHub) run(ctx context.Context) {
+	defer close(h.stopped)
+
 	// Ping ticker to keep connections alive
-	pingTicker := time.NewTicker(15 * time.Second)
+	pingTicker := time.NewTicker(h.pingInterval)
 	defer pingTicker.Stop()
 
 	for {
 		select {
-		case client := <-h.register:
+		case <-ctx.Done():
 			h.mutex.Lock()
-			h.clients[client.ID] = client
+			for clientID, client := range h.clients {
+				close(client.Events)
+				delete(h.clients, clientID)
+			}
 			h.mutex.Unlock()
-			log.Printf("📡 SSE: Client %s connected (total: %d)", client.ID, len(h.clients))
+			log.Println("📡 SSE: Event hub stopped")
+			return
 
 		case clientID := <-h.unregister:
 			h.mutex.Lock()
-			if client, ok := h.clients[clientID]; ok {
+			client, ok := h.clients[clientID]
+			if ok {
 				close(client.Events)
 				delete(h.clients, clientID)
 			}
+			total := len(h.clients)
 			h.mutex.Unlock()
-			log.Printf("📡 SSE: Client %s disconnected (total: %d)", clientID, len(h.clients))
+			if ok {
+				log.Printf("📡 SSE: Client %s disconnected (total: %d)", clientID, total)
+				h.left(client)
+			}
 
 		case event := <-h.broadcast:
-			h.mutex.RLock()
-			for _, client := range h.clients {
-				// Send to all clients (they filter by room if needed)
-				select {
-				case client.Events <- event:
-				default:
-					// Client buffer full, skip this event
-					log.Printf("⚠️ SSE: Client %s buffer full, skipping event", client.ID)
-				}
-			}
-			h.mutex.RUnlock()
+			h.resyncIfPending()
+			h.dispatch(event)
 
 		case <-pingTicker.C:
-			// Send ping to all clients
-			h.Broadcast(Event{
-				Type:      EventPing,
-				Timestamp: time.Now().UnixMilli(),
-			})
+			// Send ping to the clients of this instance
+			h.resyncIfPending()
+			h.dispatch(NewEvent(EventPing, nil))
+			h.dropStale()
+		}
+	}
+}
+
+// dispatch journals an event and queues it for the clients that want it.
+// A client whose buffer is full is disconnected rather than left missing
+// the event: it reconnects with Last-Event-ID and catches up from the
+// journal, or is asked to resync.
+func (h *EventHub) dispatch(event Event) {
+	// Journal and deliver under the write lock so a client registering
+	// concurrently gets each event exactly once: replayed or live
+	h.mutex.Lock()
+	if event.Type != EventPing {
+		h.lastID++
+		event.ID = h.lastID
+		h.journal = append(h.journal, event)
+		if len(h.journal) > eventJournalSize {
+			h.journal = h.journal[len(h.journal)-eventJournalSize:]
+		}
+	}
+	var evicted []*SSEClient
+	for clientID, client := range h.clients {
+		if !client.wants(event) {
+			continue
+		}
+		select {
+		case client.Events <- event:
+		default:
+			close(client.Events)
+			delete(h.clients, clientID)
+			evicted = append(evicted, client)
+		}
+	}
+	h.mutex.Unlock()
+
+	for _, client := range evicted {
+		h.clientsEvicted.Add(1)
+		log.Printf("⚠️ SSE: Client %s is %d events behind, disconnecting it", client.ID, clientEventBuffer)
+	}
+	// Only queues the presence events: the hub loop must never wait on the
+	// relay or on its own broadcast channel
+	h.announceLeft(evicted)
+}
+
+// resyncIfPending asks every client to resync after an event was lost
+func (h *EventHub) resyncIfPending() {
+	if h.resyncPending.CompareAndSwap(true, false) {
+		log.Println("⚠️ SSE: Events were dropped, asking clients to resync")
+		h.dispatch(NewEvent(EventResyncRequired, ResyncPayload{}))
+	}
+}
+
+// Unregister removes a client from the hub. The user of the client is
+// announced offline if it was their last connection.
+func (h *EventHub) Unregister(clientID string) {
+	select {
+	case h.unregister <- clientID:
+	case <-h.stopped:
+	}
+}
+
+// Register adds a client to the hub. When lastEventID is set, it also
+// returns the journaled events after it that the client should receive;
+// ok is false when some of them are no longer in the journal.
+// The user of the client is announced online.
+func (h *EventHub) Register(client *SSEClient, lastEventID int64) (missed []Event, ok bool) {
+	h.mutex.Lock()
+	online := h.connectionsOf(client.UserID) > 0
+	h.clients[client.ID] = client
+	log.Printf("📡 SSE: Client %s connected (total: %d)", client.ID, len(h.clients))
+	missed, ok = h.missedSince(client, lastEventID)
+	h.mutex.Unlock()
+
+	if online {
+		h.announcePresence(EventPresenceUpdated, client.UserID, client.Role)
+	} else {
+		h.announcePresence(EventUserOnline, client.UserID, client.Role)
+	}
+	return missed, ok
+}
+
+// missedSince returns the journaled events after lastEventID that a client
+// should receive. The caller holds the lock.
+func (h *EventHub) missedSince(client *SSEClient, lastEventID int64) (missed []Event, ok bool) {
+	if lastEventID <= 0 || lastEventID >= h.lastID {
+		return nil, lastEventID <= h.lastID
+	}
+	oldest := h.lastID - int64(len(h.journal)) + 1
+	if lastEventID < oldest-1 {
+		return nil, false
+	}
+	for _, event := range h.journal[lastEventID-oldest+1:] {
+		if client.wants(event) {
+			missed = append(missed, event)
 		}
 	}
+	return missed, true
 }
 
-// Broadcast sends an event to all connected clients
+// Broadcast sends an event to all connected clients, on every server
+// instance when the event relay is running
 func (h *EventHub) Broadcast(event Event) {
 	if event.Timestamp == 0 {
 		event.Timestamp = time.Now().UnixMilli()
 	}
+
+	h.mutex.RLock()
+	relay := h.relay
+	h.mutex.RUnlock()
+	if relay != nil {
+		err := relay.Publish(event)
+		if err == nil {
+			return
+		}
+		log.Printf("⚠️ SSE: Relay failed, delivering on this instance only and resyncing the others: %v", err)
+	}
+	h.deliver(event)
+}
+
+// setRelay makes Broadcast publish through an event relay, or deliver
+// locally when relay is nil
+func (h *EventHub) setRelay(relay *EventRelay) {
+	h.mutex.Lock()
+	h.relay = relay
+	h.mutex.Unlock()
+}
+
+// deliver queues an event for the clients of this instance. When the hub
+// is too far behind, the event is dropped and every client will be asked to
+// resync, since it never reaches the journal.
+func (h *EventHub) deliver(event Event) {
 	select {
 	case h.broadcast <- event:
 	default:
-		log.Printf("⚠️ SSE: Broadcast channel full, dropping event")
+		h.eventsDropped.Add(1)
+		h.resyncPending.Store(true)
+		log.Printf("⚠️ SSE: Broadcast channel full, dropping %s event", event.Type)
 	}
 }
 
@@ -192,6 +483,34 @@ func (h *EventHub) BroadcastToRoom(roomID string, event Event) {
 	h.Broadcast(event)
 }
 
+// SendToUser sends an event only to the connections of a user
+func (h *EventHub) SendToUser(userID string, event Event) {
+	event.TargetUserID = userID
+	h.Broadcast(event)
+}
+
+// SendToRoles sends an event only to users of the given role categories.
+// Administrators always receive it.
+func (h *EventHub) SendToRoles(event Event, roles ...string) {
+	event.TargetRoles = roles
+	h.Broadcast(event)
+}
+
+// SetClientRooms changes the rooms a live connection is subscribed to.
+// Only the user owning the connection may change it.
+func (h *EventHub) SetClientRooms(clientID, userID string, roomIDs []string) error {
+	h.mutex.RLock()
+	client, ok := h.clients[clientID]
+	h.mutex.RUnlock()
+	if !ok || client.UserID != userID {
+		return errUnknownClient
+	}
+	client.SetRooms(roomIDs)
+	log.Printf("📡 SSE: Client %s subscribed to rooms %v", clientID, client.Rooms())
+	h.announcePresence(EventPresenceUpdated, client.UserID, client.Role)
+	return nil
+}
+
 // ClientCount returns the number of connected clients
 func (h *EventHub) ClientCount() int {
 	h.mutex.RLock()
@@ -199,21 +518,34 @@ func (h *EventHub) ClientCount() int {
 	return len(h.clients)
 }
 
+// LastEventID returns the ID of the last event sent
+func (h *EventHub) LastEventID() int64 {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.lastID
+}
+
 // SetupSSERoutes adds SSE endpoint to the mux
 func (h *RESTHandler) SetupSSERoutes(mux *http.ServeMux) {
-	mux.HandleFunc("/api/events", h.SSEHandler)
+	mux.HandleFunc("/api/events", authorize("/api/events", h.SSEHandler))
 	mux.HandleFunc("/api/events/status", h.SSEStatusHandler)
+	mux.HandleFunc("/api/events/metrics", withCORS(authorize("/api/events/metrics", h.SSEMetricsHandler)))
+	mux.HandleFunc("/api/events/subscribe", withCORS(authorize("/api/events/subscribe", h.SSESubscribeHandler)))
+	mux.HandleFunc("/api/events/ws", authorize("/api/events/ws", h.WebSocketHandler))
+	mux.HandleFunc("/api/events/schema", withCORS(authorize("/api/events/schema", h.EventSchemaHandler)))
 	log.Println("📡 SSE real-time events endpoint registered at /api/events")
 }
 
-// SSEHandler handles Server-Sent Events connections
+// SSEHandler handles Server-Sent Events connections. Room events are only
+// delivered to clients subscribed to the room with ?room=<id> (repeatable),
+// or to every client that did not subscribe to any room.
 func (h *RESTHandler) SSEHandler(w http.ResponseWriter, r *http.Request) {
 	// Set SSE headers
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	w.Header().Set("X-Accel-Buffering", "no") // Disable nginx buffering
 
 	// Get flusher
@@ -223,51 +555,35 @@ func (h *RESTHandler) SSEHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate client ID
-	clientID := fmt.Sprintf("client_%d", time.Now().UnixNano())
-
-	// Get optional room filter from query params
-	roomIDs := r.URL.Query()["room"]
-
-	// Create client
-	client := &SSEClient{
-		ID:      clientID,
-		RoomIDs: roomIDs,
-		Events:  make(chan Event, 50), // Buffer 50 events
-		Done:    make(chan struct{}),
-	}
-
-	// Register client
-	Hub.register <- client
+	client, lastID := newStreamClient(r)
+	missed, complete := h.hub.Register(client, lastID)
 
 	// Cleanup on disconnect
 	defer func() {
-		Hub.unregister <- clientID
+		h.hub.Unregister(client.ID)
 	}()
 
-	// Send initial connection event
-	initialEvent := Event{
-		Type:      "connected",
-		Timestamp: time.Now().UnixMilli(),
-		Data:      map[string]interface{}{"client_id": clientID},
+	// Send initial connection event, then catch up
+	for _, event := range initialEvents(client, lastID, missed, complete) {
+		if err := writeSSE(w, event); err != nil {
+			return
+		}
 	}
-	data, _ := json.Marshal(initialEvent)
-	fmt.Fprintf(w, "data: %s\n\n", data)
 	flusher.Flush()
 
-	// Stream events
+	// Stream events. Each successful write counts as a sign of life.
 	for {
 		select {
 		case event, ok := <-client.Events:
 			if !ok {
 				return
 			}
-			data, err := json.Marshal(event)
-			if err != nil {
-				continue
+			if err := writeSSE(w, event); err != nil {
+				return
 			}
-			fmt.Fprintf(w, "data: %s\n\n", data)
 			flusher.Flush()
+			client.Heartbeat()
+			client.sent(event)
 
 		case <-r.Context().Done():
 			return
@@ -275,145 +591,206 @@ func (h *RESTHandler) SSEHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// SSEStatusHandler returns SSE connection status
+// newStreamClient creates the hub client of an event stream request (SSE or
+// WebSocket) and returns the ID of the last event it received before
+// reconnecting, or 0
+func newStreamClient(r *http.Request) (*SSEClient, int64) {
+	now := time.Now()
+	client := &SSEClient{
+		ID:          fmt.Sprintf("client_%d", now.UnixNano()),
+		UserID:      middleware.GetUserID(r),
+		Role:        middleware.GetUserRole(r),
+		Workstation: workstationOf(r),
+		Events:      make(chan Event, clientEventBuffer),
+		connectedAt: now,
+		lastSeen:    now,
+	}
+
+	// Get optional room filter from query params
+	client.SetRooms(r.URL.Query()["room"])
+
+	// Reconnecting clients send the last event they received, as the
+	// Last-Event-ID header or, when they cannot set headers, a query param
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	lastID, _ := strconv.ParseInt(lastEventID, 10, 64)
+	return client, lastID
+}
+
+// initialEvents returns what a newly registered client is sent first: the
+// connected event, then the events missed while disconnected or, when they
+// are no longer available, a request to reload everything
+func initialEvents(client *SSEClient, lastID int64, missed []Event, complete bool) []Event {
+	events := []Event{NewEvent(EventConnected, ConnectedPayload{
+		ClientID: client.ID,
+		Rooms:    client.Rooms(),
+	})}
+	if !complete {
+		log.Printf("📡 SSE: Client %s missed too many events, asking for resync", client.ID)
+		events = append(events, NewEvent(EventResyncRequired, ResyncPayload{LastEventID: lastID}))
+	}
+	return append(events, missed...)
+}
+
+// writeSSE writes one event in the SSE wire format, with its ID so clients
+// can resume from it
+func writeSSE(w http.ResponseWriter, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("⚠️ SSE: Cannot encode %s event: %v", event.Type, err)
+		return nil
+	}
+	if event.ID > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", event.ID); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	return err
+}
+
+// sseSubscribeRequest is the body expected by /api/events/subscribe
+type sseSubscribeRequest struct {
+	ClientID string        `json:"client_id"`
+	Rooms    []*flexibleID `json:"rooms"`
+}
+
+func (req *sseSubscribeRequest) Validate(v *validation.Validator) {
+	v.Required("client_id", req.ClientID)
+}
+
+// SSESubscribeHandler changes the rooms of a live event stream, e.g. when a
+// nurse switches rooms. The client id is sent in the "connected" event.
+func (h *RESTHandler) SSESubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	var req sseSubscribeRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	rooms := []string{}
+	for _, room := range req.Rooms {
+		if room != nil {
+			rooms = append(rooms, string(*room))
+		}
+	}
+
+	if err := h.hub.SetClientRooms(req.ClientID, middleware.GetUserID(r), rooms); err != nil {
+		respondError(w, 404, err.Error())
+		return
+	}
+
+	respondJSON(w, map[string]interface{}{"client_id": req.ClientID, "rooms": rooms})
+}
+
+// SSEStatusHandler returns SSE connection status. It needs no session, so
+// it only gives totals: the per-client metrics are at /api/events/metrics.
 func (h *RESTHandler) SSEStatusHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 
+	metrics := h.hub.Metrics()
 	status := map[string]interface{}{
-		"connected_clients": Hub.ClientCount(),
+		"connected_clients": len(metrics.Clients),
+		"last_event_id":     h.hub.LastEventID(),
 		"server_time":       time.Now().UnixMilli(),
+		"queue_depth":       metrics.QueueDepth,
+		"queue_capacity":    metrics.QueueCapacity,
+		"events_dropped":    metrics.EventsDropped,
+		"clients_evicted":   metrics.ClientsEvicted,
 	}
 	json.NewEncoder(w).Encode(status)
 }
 
-// Helper functions to broadcast events from handlers
+// SSEMetricsHandler returns the hub metrics with the backlog of every
+// client, for administrators
+func (h *RESTHandler) SSEMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, h.hub.Metrics())
+}
+
+// Helper functions to broadcast events from handlers. Payloads are listed
+// in the event catalog (events.go).
 
 // BroadcastPatientEvent broadcasts patient-related events
-func BroadcastPatientEvent(eventType EventType, patientCode int, data map[string]interface{}) {
-	if data == nil {
-		data = make(map[string]interface{})
-	}
-	data["patient_code"] = patientCode
-	Hub.Broadcast(Event{
-		Type:      eventType,
-		Data:      data,
-		Timestamp: time.Now().UnixMilli(),
-	})
+func (h *EventHub) BroadcastPatientEvent(eventType EventType, payload PatientPayload) {
+	h.Broadcast(NewEvent(eventType, payload))
 }
 
 // BroadcastMessageEvent broadcasts message-related events
-func BroadcastMessageEvent(eventType EventType, roomID string, data map[string]interface{}) {
-	Hub.BroadcastToRoom(roomID, Event{
-		Type:      eventType,
-		Data:      data,
-		Timestamp: time.Now().UnixMilli(),
-	})
+func (h *EventHub) BroadcastMessageEvent(eventType EventType, roomID string, payload interface{}) {
+	h.BroadcastToRoom(roomID, NewEvent(eventType, payload))
 }
 
 // BroadcastWaitingEvent broadcasts waiting queue events
-func BroadcastWaitingEvent(eventType EventType, roomID string, data map[string]interface{}) {
-	Hub.BroadcastToRoom(roomID, Event{
-		Type:      eventType,
-		Data:      data,
-		Timestamp: time.Now().UnixMilli(),
-	})
+func (h *EventHub) BroadcastWaitingEvent(eventType EventType, roomID string, payload interface{}) {
+	h.BroadcastToRoom(roomID, NewEvent(eventType, payload))
 }
 
 // BroadcastPaymentEvent broadcasts payment-related events
-func BroadcastPaymentEvent(eventType EventType, data map[string]interface{}) {
-	Hub.Broadcast(Event{
-		Type:      eventType,
-		Data:      data,
-		Timestamp: time.Now().UnixMilli(),
-	})
+func (h *EventHub) BroadcastPaymentEvent(eventType EventType, payload PaymentPayload) {
+	h.Broadcast(NewEvent(eventType, payload))
 }
 
 // BroadcastUserEvent broadcasts user-related events
-func BroadcastUserEvent(eventType EventType, data map[string]interface{}) {
-	Hub.Broadcast(Event{
-		Type:      eventType,
-		Data:      data,
-		Timestamp: time.Now().UnixMilli(),
-	})
+func (h *EventHub) BroadcastUserEvent(eventType EventType, payload UserPayload) {
+	h.Broadcast(NewEvent(eventType, payload))
 }
 
 // BroadcastRoomEvent broadcasts room-related events
-func BroadcastRoomEvent(eventType EventType, data map[string]interface{}) {
-	Hub.Broadcast(Event{
-		Type:      eventType,
-		Data:      data,
-		Timestamp: time.Now().UnixMilli(),
-	})
+func (h *EventHub) BroadcastRoomEvent(eventType EventType, payload KeyPayload) {
+	h.Broadcast(NewEvent(eventType, payload))
 }
 
 // BroadcastVisitEvent broadcasts visit-related events
-func BroadcastVisitEvent(eventType EventType, patientCode int, data map[string]interface{}) {
-	if data == nil {
-		data = make(map[string]interface{})
-	}
-	data["patient_code"] = patientCode
-	Hub.Broadcast(Event{
-		Type:      eventType,
-		Data:      data,
-		Timestamp: time.Now().UnixMilli(),
-	})
+func (h *EventHub) BroadcastVisitEvent(eventType EventType, payload PatientRecordPayload) {
+	h.Broadcast(NewEvent(eventType, payload))
 }
 
 // BroadcastTemplateEvent broadcasts user template events
-func BroadcastTemplateEvent(eventType EventType, data map[string]interface{}) {
-	Hub.Broadcast(Event{
-		Type:      eventType,
-		Data:      data,
-		Timestamp: time.Now().UnixMilli(),
-	})
+func (h *EventHub) BroadcastTemplateEvent(eventType EventType, payload KeyPayload) {
+	h.Broadcast(NewEvent(eventType, payload))
 }
 
 // BroadcastOrdonnanceEvent broadcasts ordonnance events
-func BroadcastOrdonnanceEvent(eventType EventType, patientCode int, data map[string]interface{}) {
-	if data == nil {
-		data = make(map[string]interface{})
-	}
-	data["patient_code"] = patientCode
-	Hub.Broadcast(Event{
-		Type:      eventType,
-		Data:      data,
-		Timestamp: time.Now().UnixMilli(),
-	})
+func (h *EventHub) BroadcastOrdonnanceEvent(eventType EventType, payload PatientRecordPayload) {
+	h.Broadcast(NewEvent(eventType, payload))
 }
 
-// BroadcastMedicalActEvent broadcasts medical act events
-func BroadcastMedicalActEvent(eventType EventType, data map[string]interface{}) {
-	Hub.Broadcast(Event{
-		Type:      eventType,
-		Data:      data,
-		Timestamp: time.Now().UnixMilli(),
-	})
+// BroadcastMedicalActEvent broadcasts medical act events, without payload
+// for reorders
+func (h *EventHub) BroadcastMedicalActEvent(eventType EventType, payload interface{}) {
+	h.Broadcast(NewEvent(eventType, payload))
 }
 
-// BroadcastMsgTemplateEvent broadcasts message template events
-func BroadcastMsgTemplateEvent(eventType EventType, data map[string]interface{}) {
-	Hub.Broadcast(Event{
-		Type:      eventType,
-		Data:      data,
-		Timestamp: time.Now().UnixMilli(),
-	})
+// BroadcastMsgTemplateEvent broadcasts message template events, without
+// payload for reorders
+func (h *EventHub) BroadcastMsgTemplateEvent(eventType EventType, payload interface{}) {
+	h.Broadcast(NewEvent(eventType, payload))
 }
 
 // BroadcastMedicationEvent broadcasts medication events
-func BroadcastMedicationEvent(eventType EventType, data map[string]interface{}) {
-	Hub.Broadcast(Event{
-		Type:      eventType,
-		Data:      data,
-		Timestamp: time.Now().UnixMilli(),
-	})
+func (h *EventHub) BroadcastMedicationEvent(eventType EventType, payload RecordPayload) {
+	h.Broadcast(NewEvent(eventType, payload))
+}
+
+// BroadcastTemplateCREvent broadcasts templates CR events
+func (h *EventHub) BroadcastTemplateCREvent(eventType EventType, payload RecordPayload) {
+	h.Broadcast(NewEvent(eventType, payload))
+}
+
+// BroadcastAppointmentEvent broadcasts appointment events
+func (h *EventHub) BroadcastAppointmentEvent(eventType EventType, payload interface{}) {
+	h.Broadcast(NewEvent(eventType, payload))
+}
+
+// BroadcastSurgeryPlanEvent broadcasts surgery plan events
+func (h *EventHub) BroadcastSurgeryPlanEvent(eventType EventType, payload SchedulePayload) {
+	h.Broadcast(NewEvent(eventType, payload))
 }
 
 // BroadcastNursePrefsEvent broadcasts nurse preference events
-func BroadcastNursePrefsEvent(eventType EventType, data map[string]interface{}) {
-	Hub.Broadcast(Event{
-		Type:      eventType,
-		Data:      data,
-		Timestamp: time.Now().UnixMilli(),
-	})
+func (h *EventHub) BroadcastNursePrefsEvent(eventType EventType, payload NursePayload) {
+	h.Broadcast(NewEvent(eventType, payload))
 }
@@ -0,0 +1,250 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// eventWait bounds how long a test waits for the hub
+const eventWait = time.Second
+
+// startHub runs a hub for the duration of the test
+func startHub(t *testing.T, ping time.Duration) *EventHub {
+	t.Helper()
+	hub := NewEventHub()
+	if ping > 0 {
+		hub.pingInterval = ping
+	}
+	hub.Start(context.Background())
+	t.Cleanup(hub.Stop)
+	return hub
+}
+
+// connect registers a client as the stream handlers do
+func connect(t *testing.T, hub *EventHub, clientID, userID, role string) *SSEClient {
+	t.Helper()
+	now := time.Now()
+	client := &SSEClient{
+		ID:          clientID,
+		UserID:      userID,
+		Role:        role,
+		Events:      make(chan Event, clientEventBuffer),
+		connectedAt: now,
+		lastSeen:    now,
+	}
+	hub.Register(client, 0)
+	return client
+}
+
+// waitFor returns the first event of a type the client receives, skipping
+// the others. It fails if the stream ends or nothing comes in time.
+func waitFor(t *testing.T, client *SSEClient, eventType EventType) (event Event, skipped []Event) {
+	t.Helper()
+	timeout := time.After(eventWait)
+	for {
+		select {
+		case event, ok := <-client.Events:
+			if !ok {
+				t.Fatalf("%s: stream closed while waiting for %s", client.ID, eventType)
+			}
+			if event.Type == eventType {
+				return event, skipped
+			}
+			skipped = append(skipped, event)
+		case <-timeout:
+			t.Fatalf("%s: no %s event", client.ID, eventType)
+		}
+	}
+}
+
+// waitClosed fails unless the hub closes the client's stream
+func waitClosed(t *testing.T, client *SSEClient) {
+	t.Helper()
+	timeout := time.After(eventWait)
+	for {
+		select {
+		case _, ok := <-client.Events:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("%s: stream still open", client.ID)
+		}
+	}
+}
+
+func TestHubBroadcastReachesEveryClient(t *testing.T) {
+	hub := startHub(t, 0)
+	doctor := connect(t, hub, "c1", "dr.test", "Médecin")
+	nurse := connect(t, hub, "c2", "nurse.test", "Infirmière")
+
+	hub.BroadcastPatientEvent(EventPatientCreated, PatientPayload{PatientCode: 42})
+
+	for _, client := range []*SSEClient{doctor, nurse} {
+		event, _ := waitFor(t, client, EventPatientCreated)
+		if event.ID == 0 {
+			t.Errorf("%s: event has no ID", client.ID)
+		}
+		if payload, ok := event.Data.(PatientPayload); !ok || payload.PatientCode != 42 {
+			t.Errorf("%s: payload %#v", client.ID, event.Data)
+		}
+	}
+}
+
+func TestHubRegisterAnnouncesPresence(t *testing.T) {
+	hub := startHub(t, 0)
+	doctor := connect(t, hub, "c1", "dr.test", "Médecin")
+	if event, _ := waitFor(t, doctor, EventUserOnline); event.Data.(UserPresence).UserID != "dr.test" {
+		t.Errorf("first user_online for %#v, want dr.test", event.Data)
+	}
+
+	connect(t, hub, "c2", "nurse.test", "Infirmière")
+	if event, _ := waitFor(t, doctor, EventUserOnline); event.Data.(UserPresence).UserID != "nurse.test" {
+		t.Errorf("user_online for %#v, want nurse.test", event.Data)
+	}
+	waitFor(t, doctor, EventNurseActive)
+
+	// A second connection of the same user only updates their presence
+	connect(t, hub, "c3", "nurse.test", "Infirmière")
+	event, _ := waitFor(t, doctor, EventPresenceUpdated)
+	if presence := event.Data.(UserPresence); presence.UserID != "nurse.test" || len(presence.Connections) != 2 {
+		t.Errorf("presence_updated %#v, want nurse.test with 2 connections", presence)
+	}
+	if hub.ClientCount() != 3 {
+		t.Errorf("%d clients, want 3", hub.ClientCount())
+	}
+}
+
+func TestHubUnregisterClosesTheStream(t *testing.T) {
+	hub := startHub(t, 0)
+	doctor := connect(t, hub, "c1", "dr.test", "Médecin")
+	nurse := connect(t, hub, "c2", "nurse.test", "Infirmière")
+
+	hub.Unregister(nurse.ID)
+	waitClosed(t, nurse)
+
+	event, _ := waitFor(t, doctor, EventUserOffline)
+	if user := event.Data.(UserPresence).UserID; user != "nurse.test" {
+		t.Errorf("user_offline for %s, want nurse.test", user)
+	}
+	// Nurses also get the older event
+	if event, _ := waitFor(t, doctor, EventNurseInactive); event.Data.(NursePayload).NurseID != "nurse.test" {
+		t.Errorf("nurse_inactive payload %#v", event.Data)
+	}
+	if hub.ClientCount() != 1 {
+		t.Errorf("%d clients, want 1", hub.ClientCount())
+	}
+
+	// Unregistering twice is harmless
+	hub.Unregister(nurse.ID)
+}
+
+func TestHubRoomFiltering(t *testing.T) {
+	hub := startHub(t, 0)
+	inRoom := connect(t, hub, "c1", "nurse.one", "Infirmière")
+	otherRoom := connect(t, hub, "c2", "nurse.two", "Infirmière")
+	allRooms := connect(t, hub, "c3", "dr.test", "Médecin")
+
+	if err := hub.SetClientRooms(inRoom.ID, "nurse.one", []string{"room1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := hub.SetClientRooms(otherRoom.ID, "nurse.two", []string{"room2", ""}); err != nil {
+		t.Fatal(err)
+	}
+	if err := hub.SetClientRooms(otherRoom.ID, "nurse.one", []string{"room1"}); err != errUnknownClient {
+		t.Errorf("changing the rooms of another user's connection: %v", err)
+	}
+	if rooms := otherRoom.Rooms(); len(rooms) != 1 || rooms[0] != "room2" {
+		t.Errorf("rooms %v, want [room2]", rooms)
+	}
+
+	hub.BroadcastMessageEvent(EventMessageCreated, "room1", MessageCreatedPayload{ID: 7, Content: "Salle 1"})
+	// Events are dispatched in order, so clients outside the room get the
+	// marker without the room event before it
+	hub.BroadcastPatientEvent(EventPatientUpdated, PatientPayload{PatientCode: 1})
+
+	for _, client := range []*SSEClient{inRoom, allRooms} {
+		event, _ := waitFor(t, client, EventMessageCreated)
+		if event.RoomID != "room1" {
+			t.Errorf("%s: room %q", client.ID, event.RoomID)
+		}
+	}
+	_, skipped := waitFor(t, otherRoom, EventPatientUpdated)
+	for _, event := range skipped {
+		if event.Type == EventMessageCreated {
+			t.Errorf("%s received an event of a room it is not in", otherRoom.ID)
+		}
+	}
+}
+
+func TestHubTargetedEvents(t *testing.T) {
+	hub := startHub(t, 0)
+	doctor := connect(t, hub, "c1", "dr.test", "Médecin")
+	nurse := connect(t, hub, "c2", "nurse.test", "Infirmière")
+
+	hub.SendToUser("nurse.test", NewEvent(EventNursePrefsUpdated, NursePayload{NurseID: "nurse.test"}))
+	hub.BroadcastPatientEvent(EventPatientUpdated, PatientPayload{PatientCode: 1})
+
+	waitFor(t, nurse, EventNursePrefsUpdated)
+	_, skipped := waitFor(t, doctor, EventPatientUpdated)
+	for _, event := range skipped {
+		if event.Type == EventNursePrefsUpdated {
+			t.Error("an event for nurse.test reached dr.test")
+		}
+	}
+}
+
+func TestHubReplaysMissedEvents(t *testing.T) {
+	hub := startHub(t, 0)
+	watcher := connect(t, hub, "c1", "dr.test", "Médecin")
+
+	hub.BroadcastPatientEvent(EventPatientCreated, PatientPayload{PatientCode: 1})
+	hub.BroadcastPatientEvent(EventPatientUpdated, PatientPayload{PatientCode: 1})
+	created, _ := waitFor(t, watcher, EventPatientCreated)
+	updated, _ := waitFor(t, watcher, EventPatientUpdated)
+
+	returning := &SSEClient{ID: "c2", UserID: "nurse.test", Events: make(chan Event, clientEventBuffer), lastSeen: time.Now()}
+	missed, ok := hub.Register(returning, created.ID)
+	if !ok {
+		t.Fatal("missed events reported as lost")
+	}
+	if len(missed) != 1 || missed[0].ID != updated.ID {
+		t.Errorf("missed %v, want the patient_updated event", missed)
+	}
+
+	// IDs before the journal cannot be replayed
+	if _, ok := hub.Register(&SSEClient{ID: "c3", UserID: "nurse.test", Events: make(chan Event, clientEventBuffer), lastSeen: time.Now()}, 1); ok {
+		t.Error("events older than the journal reported as replayable")
+	}
+}
+
+func TestHubPings(t *testing.T) {
+	hub := startHub(t, 10*time.Millisecond)
+	client := connect(t, hub, "c1", "dr.test", "Médecin")
+
+	event, _ := waitFor(t, client, EventPing)
+	if event.ID != 0 {
+		t.Errorf("ping has ID %d, pings are not journaled", event.ID)
+	}
+	if hub.ClientCount() != 1 {
+		t.Error("a live client was dropped on ping")
+	}
+}
+
+func TestHubStopClosesEveryStream(t *testing.T) {
+	hub := NewEventHub()
+	hub.Start(context.Background())
+	clients := []*SSEClient{
+		connect(t, hub, "c1", "dr.test", "Médecin"),
+		connect(t, hub, "c2", "nurse.test", "Infirmière"),
+	}
+
+	hub.Stop()
+	for _, client := range clients {
+		waitClosed(t, client)
+	}
+	if hub.ClientCount() != 0 {
+		t.Errorf("%d clients left after Stop", hub.ClientCount())
+	}
+}
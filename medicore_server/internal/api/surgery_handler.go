@@ -0,0 +1,220 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"medicore/internal/models"
+	"medicore/internal/repository"
+	"medicore/internal/services"
+	"medicore/internal/validation"
+)
+
+// Values accepted for the surgery plan enumerations
+var (
+	eyesToOperate   = []string{"OD", "OG", "ODG"}
+	paymentStatuses = []string{"pending", "partial", "paid"}
+	surgeryStatuses = []string{"scheduled", "done", "cancelled"}
+)
+
+// surgeryPlanRequest is the body of CreateSurgeryPlan
+type surgeryPlanRequest struct{ models.SurgeryPlan }
+
+func (req *surgeryPlanRequest) Validate(v *validation.Validator) {
+	v.RequiredTime("surgery_date", req.SurgeryDate)
+	v.RequiredID("patient_code", int64(req.PatientCode))
+	v.Required("surgery_type", req.SurgeryType)
+	v.OneOf("eye_to_operate", req.EyeToOperate, eyesToOperate...)
+	if req.Tarif != nil {
+		v.Min("tarif", int64(*req.Tarif), 0)
+	}
+	if req.PatientAge != nil {
+		v.Range("patient_age", int64(*req.PatientAge), 0, 150)
+	}
+}
+
+// updateSurgeryPlanRequest is the body of UpdateSurgeryPlan and
+// RescheduleSurgery
+type updateSurgeryPlanRequest struct {
+	ID int64 `json:"id"`
+	models.SurgeryPlanChanges
+}
+
+func (req *updateSurgeryPlanRequest) Validate(v *validation.Validator) {
+	v.RequiredID("id", req.ID)
+	if req.SurgeryDate != nil {
+		v.Time("surgery_date", *req.SurgeryDate)
+	}
+	if req.EyeToOperate != nil {
+		v.OneOf("eye_to_operate", *req.EyeToOperate, eyesToOperate...)
+	}
+	if req.PaymentStatus != nil {
+		v.OneOf("payment_status", *req.PaymentStatus, paymentStatuses...)
+	}
+	if req.SurgeryStatus != nil {
+		v.OneOf("surgery_status", *req.SurgeryStatus, surgeryStatuses...)
+	}
+	if req.Tarif != nil {
+		v.Min("tarif", int64(*req.Tarif), 0)
+	}
+	if req.AmountRemaining != nil {
+		v.Min("amount_remaining", int64(*req.AmountRemaining), 0)
+	}
+}
+
+// rescheduleSurgeryRequest is the body of RescheduleSurgery
+type rescheduleSurgeryRequest struct{ updateSurgeryPlanRequest }
+
+func (req *rescheduleSurgeryRequest) Validate(v *validation.Validator) {
+	req.updateSurgeryPlanRequest.Validate(v)
+	v.Check(req.SurgeryDate != nil && !req.SurgeryDate.IsZero(), "surgery_date", "is required")
+}
+
+// ==================== SURGERY PLAN HANDLERS ====================
+
+func (h *RESTHandler) GetSurgeryPlansForDate(w http.ResponseWriter, r *http.Request) {
+	var req dateRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	plans, err := h.surgery.GetForDate(req.Date.Time)
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	respondJSON(w, map[string]interface{}{"surgery_plans": plans})
+}
+
+func (h *RESTHandler) GetAllSurgeryPlans(w http.ResponseWriter, r *http.Request) {
+	plans, err := h.surgery.GetAll()
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	respondJSON(w, map[string]interface{}{"surgery_plans": plans})
+}
+
+func (h *RESTHandler) CreateSurgeryPlan(w http.ResponseWriter, r *http.Request) {
+	var req surgeryPlanRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	id, err := h.surgery.Create(&req.SurgeryPlan)
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	h.recordAudit(r, services.AuditCreate, "surgery_plans", id, nil, h.snapshot("surgery_plans", id))
+	h.hub.BroadcastSurgeryPlanEvent(EventSurgeryPlanCreated, SchedulePayload{
+		ID:          id,
+		Date:        req.SurgeryDate.Format(dayLayout),
+		PatientCode: req.PatientCode,
+	})
+	respondJSON(w, map[string]interface{}{"id": id})
+}
+
+func (h *RESTHandler) UpdateSurgeryPlan(w http.ResponseWriter, r *http.Request) {
+	var req updateSurgeryPlanRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+	id := req.ID
+
+	// Moving a surgery to another day goes through RescheduleSurgery
+	changes := req.SurgeryPlanChanges
+	changes.SurgeryDate = nil
+
+	if !h.requireSurgeryPlan(w, id) {
+		return
+	}
+	oldValues := h.snapshot("surgery_plans", id)
+
+	updated, err := h.surgery.Update(id, &changes)
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	if updated {
+		h.recordAudit(r, services.AuditUpdate, "surgery_plans", id, oldValues, h.snapshot("surgery_plans", id))
+		h.hub.BroadcastSurgeryPlanEvent(EventSurgeryPlanUpdated, SchedulePayload{ID: id})
+	}
+	respondJSON(w, map[string]interface{}{"success": true})
+}
+
+func (h *RESTHandler) RescheduleSurgery(w http.ResponseWriter, r *http.Request) {
+	var req rescheduleSurgeryRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+	id := req.ID
+
+	// Rescheduling may also change the slot and the surgery itself
+	changes := models.SurgeryPlanChanges{
+		SurgeryDate:  req.SurgeryDate,
+		SurgeryHour:  req.SurgeryHour,
+		SurgeryType:  req.SurgeryType,
+		EyeToOperate: req.EyeToOperate,
+		ImplantPower: req.ImplantPower,
+		Tarif:        req.Tarif,
+	}
+
+	if !h.requireSurgeryPlan(w, id) {
+		return
+	}
+	oldValues := h.snapshot("surgery_plans", id)
+
+	if _, err := h.surgery.Update(id, &changes); err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	h.recordAudit(r, services.AuditUpdate, "surgery_plans", id, oldValues, h.snapshot("surgery_plans", id))
+	h.hub.BroadcastSurgeryPlanEvent(EventSurgeryPlanUpdated, SchedulePayload{ID: id, Date: req.SurgeryDate.Format(dayLayout)})
+	respondJSON(w, map[string]interface{}{"success": true})
+}
+
+func (h *RESTHandler) DeleteSurgeryPlan(w http.ResponseWriter, r *http.Request) {
+	var req idRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	id := req.ID
+	plan, err := h.surgery.GetByID(id)
+	if errors.Is(err, repository.ErrNotFound) {
+		respondError(w, 404, "surgery plan not found")
+		return
+	}
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	oldValues := h.snapshot("surgery_plans", id)
+	if err := h.surgery.Delete(id); err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	h.recordAudit(r, services.AuditDelete, "surgery_plans", id, oldValues, nil)
+	h.hub.BroadcastSurgeryPlanEvent(EventSurgeryPlanDeleted, SchedulePayload{ID: id, PatientCode: plan.PatientCode})
+	respondJSON(w, map[string]interface{}{"success": true})
+}
+
+// requireSurgeryPlan answers 404 when a surgery plan does not exist
+func (h *RESTHandler) requireSurgeryPlan(w http.ResponseWriter, id int64) bool {
+	_, err := h.surgery.GetByID(id)
+	if errors.Is(err, repository.ErrNotFound) {
+		respondError(w, 404, "surgery plan not found")
+		return false
+	}
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return false
+	}
+	return true
+}
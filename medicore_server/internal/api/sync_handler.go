@@ -0,0 +1,47 @@
+package api
+
+import (
+	"net/http"
+
+	"medicore/internal/middleware"
+	"medicore/internal/repository"
+	"medicore/internal/validation"
+)
+
+// changesRequest is the body of GetChanges
+type changesRequest struct {
+	Cursor int64 `json:"cursor"`
+}
+
+func (req *changesRequest) Validate(v *validation.Validator) {
+	v.Min("cursor", req.Cursor, 0)
+}
+
+// ==================== DELTA SYNC HANDLERS ====================
+
+// GetChanges lets clients keep a local copy of the patients, visits,
+// payments, documents, appointments and surgery plans. It returns the rows
+// written since the cursor returned by the previous call, with the keys of
+// the rows deleted since, and the cursor for the next call. Cursor 0, or a
+// cursor too old, returns every row with "full": true.
+func (h *RESTHandler) GetChanges(w http.ResponseWriter, r *http.Request) {
+	var req changesRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	changes, err := repository.NewSyncRepository(h.db).Changes(req.Cursor)
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+
+	// Payments are only readable by doctors and assistants
+	if !middleware.HasRole(middleware.GetUserRole(r), doctorsAssists...) {
+		changes.Payments = nil
+		delete(changes.Deleted, "payments")
+	}
+
+	respondJSON(w, changes)
+}
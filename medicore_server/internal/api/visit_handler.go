@@ -0,0 +1,191 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"medicore/internal/models"
+	"medicore/internal/repository"
+	"medicore/internal/services"
+	"medicore/internal/validation"
+)
+
+// visitRequest is the body of CreateVisit and UpdateVisit
+type visitRequest struct{ models.Visit }
+
+func (req *visitRequest) validate(v *validation.Validator) {
+	v.RequiredID("patient_code", int64(req.PatientCode))
+	v.Min("visit_sequence", int64(req.VisitSequence), 0)
+	v.Date("visit_date", req.VisitDate)
+}
+
+type createVisitRequest struct{ visitRequest }
+
+func (req *createVisitRequest) Validate(v *validation.Validator) {
+	req.validate(v)
+}
+
+type updateVisitRequest struct{ visitRequest }
+
+func (req *updateVisitRequest) Validate(v *validation.Validator) {
+	v.RequiredID("id", req.ID)
+	req.validate(v)
+}
+
+// patientRowRequest is the body of requests deleting one row of a patient
+type patientRowRequest struct {
+	ID          int64 `json:"id"`
+	PatientCode int   `json:"patient_code"`
+}
+
+func (req *patientRowRequest) Validate(v *validation.Validator) {
+	v.RequiredID("id", req.ID)
+}
+
+// visitsRequest is the body of InsertVisits
+type visitsRequest struct {
+	Visits []models.Visit `json:"visits"`
+}
+
+func (req *visitsRequest) Validate(v *validation.Validator) {
+	v.Check(req.Visits != nil, "visits", "is required")
+	for i, visit := range req.Visits {
+		v.RequiredID(fmt.Sprintf("visits.%d.patient_code", i), int64(visit.PatientCode))
+	}
+}
+
+// ==================== VISIT HANDLERS ====================
+
+func (h *RESTHandler) GetVisitsForPatient(w http.ResponseWriter, r *http.Request) {
+	var req patientCodeRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	visits, err := h.visits.GetForPatient(req.PatientCode)
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	respondJSON(w, map[string]interface{}{"visits": visits})
+}
+
+func (h *RESTHandler) GetVisitById(w http.ResponseWriter, r *http.Request) {
+	var req idRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	visit, err := h.visits.GetByID(req.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		respondJSON(w, map[string]interface{}{})
+		return
+	}
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	respondJSON(w, visit)
+}
+
+func (h *RESTHandler) CreateVisit(w http.ResponseWriter, r *http.Request) {
+	var req createVisitRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+	if req.VisitSequence == 0 {
+		req.VisitSequence = 1
+	}
+
+	id, err := h.visits.Create(&req.Visit)
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	h.recordAudit(r, services.AuditCreate, "visits", id, nil, h.snapshot("visits", id))
+	h.hub.BroadcastVisitEvent(EventVisitCreated, PatientRecordPayload{ID: id, PatientCode: req.PatientCode})
+	respondJSON(w, map[string]interface{}{"id": id})
+}
+
+func (h *RESTHandler) UpdateVisit(w http.ResponseWriter, r *http.Request) {
+	var req updateVisitRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+	id := req.ID
+	oldValues := h.snapshot("visits", id)
+	err := h.visits.Update(&req.Visit)
+	if errors.Is(err, repository.ErrNotFound) {
+		respondError(w, 404, "visit not found")
+		return
+	}
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	h.recordAudit(r, services.AuditUpdate, "visits", id, oldValues, h.snapshot("visits", id))
+	h.hub.BroadcastVisitEvent(EventVisitUpdated, PatientRecordPayload{ID: id, PatientCode: req.PatientCode})
+	respondJSON(w, map[string]interface{}{})
+}
+
+func (h *RESTHandler) DeleteVisit(w http.ResponseWriter, r *http.Request) {
+	var req patientRowRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+	id := req.ID
+	oldValues := h.snapshot("visits", id)
+	err := h.visits.Delete(id)
+	if errors.Is(err, repository.ErrNotFound) {
+		respondError(w, 404, "visit not found")
+		return
+	}
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	h.recordAudit(r, services.AuditDelete, "visits", id, oldValues, h.snapshot("visits", id))
+	h.hub.BroadcastVisitEvent(EventVisitDeleted, PatientRecordPayload{ID: id, PatientCode: req.PatientCode})
+	respondJSON(w, map[string]interface{}{})
+}
+
+// ==================== ADDITIONAL VISIT HANDLERS ====================
+
+func (h *RESTHandler) GetTotalVisitCount(w http.ResponseWriter, r *http.Request) {
+	count, _ := h.visits.Count()
+	respondJSON(w, map[string]interface{}{"count": count})
+}
+
+func (h *RESTHandler) ClearAllVisits(w http.ResponseWriter, r *http.Request) {
+	count, err := h.visits.DeleteAll()
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+
+	// Snapshotting the whole table is not practical, keep the count only
+	h.recordAudit(r, services.AuditDelete, "visits", "all", json.RawMessage(fmt.Sprintf(`{"count": %d}`, count)), nil)
+
+	respondJSON(w, map[string]interface{}{"deleted": count})
+}
+
+func (h *RESTHandler) InsertVisits(w http.ResponseWriter, r *http.Request) {
+	var req visitsRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	insertedCount := h.visits.InsertAll(req.Visits)
+
+	h.recordAudit(r, services.AuditCreate, "visits", "bulk", nil, json.RawMessage(fmt.Sprintf(`{"count": %d}`, insertedCount)))
+
+	respondJSON(w, map[string]interface{}{"inserted": insertedCount})
+}
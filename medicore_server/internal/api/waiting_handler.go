@@ -0,0 +1,208 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"medicore/internal/models"
+	"medicore/internal/repository"
+	"medicore/internal/validation"
+)
+
+// addWaitingPatientRequest is the body of AddWaitingPatient. Some clients
+// send the room id as a number.
+type addWaitingPatientRequest struct {
+	models.WaitingPatient
+	RoomID flexibleID `json:"room_id"`
+}
+
+func (req *addWaitingPatientRequest) Validate(v *validation.Validator) {
+	v.RequiredID("patient_code", int64(req.PatientCode))
+	v.Required("room_id", string(req.RoomID))
+	if req.PatientAge != nil {
+		v.Range("patient_age", int64(*req.PatientAge), 0, 150)
+	}
+}
+
+// updateWaitingPatientRequest is the body of UpdateWaitingPatient
+type updateWaitingPatientRequest struct {
+	ID        int64 `json:"id"`
+	IsChecked *bool `json:"is_checked"`
+	IsActive  *bool `json:"is_active"`
+}
+
+func (req *updateWaitingPatientRequest) Validate(v *validation.Validator) {
+	v.RequiredID("id", req.ID)
+}
+
+// roomIDsRequest is the body of MarkDilatationsAsNotified
+type roomIDsRequest struct {
+	RoomIDs []flexibleID `json:"room_ids"`
+}
+
+func (req *roomIDsRequest) Validate(v *validation.Validator) {
+	v.Check(req.RoomIDs != nil, "room_ids", "is required")
+}
+
+// ==================== WAITING PATIENT HANDLERS ====================
+
+func (h *RESTHandler) GetWaitingPatientsByRoom(w http.ResponseWriter, r *http.Request) {
+	var req roomIDRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	patients, err := h.waiting.GetByRoom(string(req.RoomID))
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	respondJSON(w, map[string]interface{}{"patients": patients})
+}
+
+func (h *RESTHandler) GetWaitingPatientById(w http.ResponseWriter, r *http.Request) {
+	var req idRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	patient, err := h.waiting.GetByID(req.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		respondJSON(w, map[string]interface{}{})
+		return
+	}
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	respondJSON(w, patient)
+}
+
+func (h *RESTHandler) AddWaitingPatient(w http.ResponseWriter, r *http.Request) {
+	var req addWaitingPatientRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+	req.WaitingPatient.RoomID = string(req.RoomID)
+
+	id, err := h.waiting.Add(&req.WaitingPatient)
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+
+	// Broadcast SSE event for real-time sync - critical for nurse notifications!
+	eventType := EventWaitingAdded
+	if req.IsDilatation {
+		eventType = EventDilatationAdded
+	}
+	h.hub.BroadcastWaitingEvent(eventType, req.WaitingPatient.RoomID, WaitingAddedPayload{
+		ID:               id,
+		PatientCode:      req.PatientCode,
+		PatientFirstName: req.PatientFirstName,
+		PatientLastName:  req.PatientLastName,
+		IsUrgent:         req.IsUrgent,
+		IsDilatation:     req.IsDilatation,
+		Motif:            req.Motif,
+	})
+
+	respondJSON(w, map[string]interface{}{"id": id})
+}
+
+func (h *RESTHandler) UpdateWaitingPatient(w http.ResponseWriter, r *http.Request) {
+	var req updateWaitingPatientRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	// Get room_id for SSE broadcast
+	roomID := h.waiting.RoomOf(req.ID)
+
+	// If is_checked is true from Flutter toggleChecked, we toggle the current value
+	var err error
+	if req.IsChecked != nil && *req.IsChecked {
+		err = h.waiting.ToggleChecked(req.ID)
+	} else {
+		err = h.waiting.SetFlags(req.ID, req.IsChecked, req.IsActive)
+	}
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+
+	// Broadcast SSE event for real-time sync
+	h.hub.BroadcastWaitingEvent(EventWaitingUpdated, roomID, RecordPayload{ID: req.ID})
+
+	respondJSON(w, map[string]interface{}{})
+}
+
+func (h *RESTHandler) RemoveWaitingPatient(w http.ResponseWriter, r *http.Request) {
+	var req idRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	// Get room_id and patient_code for SSE broadcast
+	var removed WaitingRemovedPayload
+	var roomID string
+	if entry, err := h.waiting.GetByID(req.ID); err == nil {
+		removed = WaitingRemovedPayload{ID: entry.ID, PatientCode: entry.PatientCode}
+		roomID = entry.RoomID
+	}
+
+	if err := h.waiting.Remove(req.ID); err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+
+	// Broadcast SSE event for real-time sync
+	if removed.ID > 0 {
+		h.hub.BroadcastWaitingEvent(EventWaitingRemoved, roomID, removed)
+	}
+
+	respondJSON(w, map[string]interface{}{})
+}
+
+func (h *RESTHandler) RemoveWaitingPatientByCode(w http.ResponseWriter, r *http.Request) {
+	var req patientCodeRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	// Get room_id for SSE broadcast before removing
+	roomID := h.waiting.ActiveRoomOfPatient(req.PatientCode)
+
+	if err := h.waiting.RemoveByPatient(req.PatientCode); err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+
+	// Broadcast SSE event for real-time sync
+	h.hub.BroadcastWaitingEvent(EventWaitingRemoved, roomID, WaitingRemovedPayload{PatientCode: req.PatientCode})
+
+	respondJSON(w, map[string]interface{}{})
+}
+
+func (h *RESTHandler) MarkDilatationsAsNotified(w http.ResponseWriter, r *http.Request) {
+	var req roomIDsRequest
+	if err := decodeBody(r, &req); err != nil {
+		respondInvalid(w, err)
+		return
+	}
+
+	for _, roomID := range req.RoomIDs {
+		if err := h.waiting.MarkDilatationsNotified(string(roomID)); err != nil {
+			respondError(w, 500, err.Error())
+			return
+		}
+		h.hub.BroadcastWaitingEvent(EventDilatationsNotified, string(roomID), nil)
+	}
+
+	respondJSON(w, map[string]interface{}{})
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsWriteWait is the time allowed to write a message to the client
+	wsWriteWait = 10 * time.Second
+	// wsPongWait is how long the client may stay silent before it is dropped
+	wsPongWait = 60 * time.Second
+	// wsPingPeriod must be shorter than wsPongWait
+	wsPingPeriod = 45 * time.Second
+	// wsMaxCommandSize bounds the messages a client may send
+	wsMaxCommandSize = 4096
+)
+
+// WebSocket command types sent by clients
+const (
+	wsCommandAck       = "ack"       // Confirms the events up to event_id were processed
+	wsCommandHeartbeat = "heartbeat" // Presence heartbeat
+	wsCommandSubscribe = "subscribe" // Replaces the room subscriptions with rooms
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// Clients are desktop apps on the LAN, like for the REST API (CORS *)
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// wsCommand is a message sent by a WebSocket client
+type wsCommand struct {
+	Type    string        `json:"type"`
+	EventID int64         `json:"event_id"` // ack
+	Rooms   []*flexibleID `json:"rooms"`    // subscribe
+}
+
+// WebSocketHandler carries the same event stream as SSEHandler, with the
+// same Event JSON and ?room= / ?last_event_id= parameters, and also accepts
+// client commands (see wsCommand)
+func (h *RESTHandler) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade already answered the request
+		log.Printf("⚠️ WS: Upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	client, lastID := newStreamClient(r)
+	missed, complete := h.hub.Register(client, lastID)
+	defer func() {
+		h.hub.Unregister(client.ID)
+	}()
+
+	// Replies to commands go through the writer, the only goroutine
+	// allowed to write to the connection
+	replies := make(chan Event, 10)
+	done := make(chan struct{})
+	go wsWriter(conn, client, initialEvents(client, lastID, missed, complete), replies, done)
+
+	conn.SetReadLimit(wsMaxCommandSize)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		client.Heartbeat()
+		return nil
+	})
+
+	defer close(done)
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("⚠️ WS: Client %s: %v", client.ID, err)
+			}
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+
+		if reply := h.handleWSCommand(client, message); reply != nil {
+			select {
+			case replies <- *reply:
+			default:
+				log.Printf("⚠️ WS: Client %s not reading replies, skipping one", client.ID)
+			}
+		}
+	}
+}
+
+// handleWSCommand applies a client command and returns the reply to send,
+// if any
+func (h *RESTHandler) handleWSCommand(client *SSEClient, message []byte) *Event {
+	var cmd wsCommand
+	if err := json.Unmarshal(message, &cmd); err != nil {
+		return wsError("invalid command: " + err.Error())
+	}
+
+	switch cmd.Type {
+	case wsCommandAck:
+		client.Ack(cmd.EventID)
+		return nil
+
+	case wsCommandHeartbeat:
+		client.Heartbeat()
+		return nil
+
+	case wsCommandSubscribe:
+		rooms := []string{}
+		for _, room := range cmd.Rooms {
+			if room != nil {
+				rooms = append(rooms, string(*room))
+			}
+		}
+		client.SetRooms(rooms)
+		log.Printf("📡 WS: Client %s subscribed to rooms %v", client.ID, client.Rooms())
+		h.hub.announcePresence(EventPresenceUpdated, client.UserID, client.Role)
+		reply := NewEvent(EventSubscribed, SubscriptionPayload{Rooms: client.Rooms()})
+		return &reply
+	}
+	return wsError("unknown command type: " + cmd.Type)
+}
+
+// wsError returns a command_error reply
+func wsError(message string) *Event {
+	reply := NewEvent(EventCommandError, ErrorPayload{Message: message})
+	return &reply
+}
+
+// wsWriter sends the initial events, then hub events and command replies,
+// until the client is unregistered or the reader stops
+func wsWriter(conn *websocket.Conn, client *SSEClient, initial []Event, replies <-chan Event, done <-chan struct{}) {
+	pingTicker := time.NewTicker(wsPingPeriod)
+	defer pingTicker.Stop()
+
+	write := func(event Event) bool {
+		conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		if err := conn.WriteJSON(event); err != nil {
+			conn.Close() // Unblocks the reader
+			return false
+		}
+		client.sent(event)
+		return true
+	}
+
+	for _, event := range initial {
+		if !write(event) {
+			return
+		}
+	}
+
+	for {
+		select {
+		case event, ok := <-client.Events:
+			if !ok {
+				conn.Close()
+				return
+			}
+			if !write(event) {
+				return
+			}
+
+		case event := <-replies:
+			if !write(event) {
+				return
+			}
+
+		case <-pingTicker.C:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				conn.Close()
+				return
+			}
+
+		case <-done:
+			return
+		}
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log"
 	"sort"
+
+	"medicore/internal/repository"
 )
 
 // Migration represents a database migration
@@ -29,6 +31,17 @@ func NewMigrationManager(db *sql.DB) *MigrationManager {
 	}
 }
 
+// Migrate brings a database up to the current schema
+func Migrate(db *sql.DB) error {
+	migrations := NewMigrationManager(db)
+	migrations.RegisterMigration(InitialSchema())
+	migrations.RegisterMigration(PostgresColumns())
+	migrations.RegisterMigration(PatientSoftDelete())
+	migrations.RegisterMigration(PatientBarcodes())
+	migrations.RegisterMigration(SyncTracking())
+	return migrations.Up()
+}
+
 // RegisterMigration adds a migration to the manager
 func (m *MigrationManager) RegisterMigration(migration Migration) {
 	m.migrations = append(m.migrations, migration)
@@ -218,3 +231,172 @@ func InitialSchema() Migration {
 		},
 	}
 }
+
+// PostgresColumns adds the columns and tables the handlers expect but the
+// first PostgreSQL schema lacked (version 2)
+func PostgresColumns() Migration {
+	return Migration{
+		Version:     2,
+		Description: "Add medical_acts.is_active and templates_cr",
+		Up: func(db *sql.DB) error {
+			_, err := db.Exec(`
+				ALTER TABLE medical_acts ADD COLUMN IF NOT EXISTS is_active BOOLEAN DEFAULT TRUE;
+				CREATE TABLE IF NOT EXISTS templates_cr (
+					id SERIAL PRIMARY KEY,
+					code VARCHAR(255) NOT NULL,
+					content TEXT NOT NULL,
+					usage_count INTEGER DEFAULT 0,
+					created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+				);
+			`)
+			return err
+		},
+		Down: func(db *sql.DB) error {
+			_, err := db.Exec(`
+				DROP TABLE IF EXISTS templates_cr;
+				ALTER TABLE medical_acts DROP COLUMN IF EXISTS is_active;
+			`)
+			return err
+		},
+	}
+}
+
+// PatientSoftDelete adds deleted_at to patients and every table holding
+// patient data, so a deleted patient can be restored (version 3)
+func PatientSoftDelete() Migration {
+	return Migration{
+		Version:     3,
+		Description: "Soft delete patients and their related data",
+		Up: func(db *sql.DB) error {
+			_, err := db.Exec(`
+				ALTER TABLE patients ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+				ALTER TABLE visits ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+				ALTER TABLE payments ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+				ALTER TABLE ordonnances ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+				ALTER TABLE messages ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+				ALTER TABLE waiting_patients ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+				ALTER TABLE appointments ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+				ALTER TABLE surgery_plans ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+				CREATE INDEX IF NOT EXISTS idx_patients_deleted ON patients(deleted_at) WHERE deleted_at IS NOT NULL;
+			`)
+			return err
+		},
+		Down: func(db *sql.DB) error {
+			_, err := db.Exec(`
+				DROP INDEX IF EXISTS idx_patients_deleted;
+				ALTER TABLE surgery_plans DROP COLUMN IF EXISTS deleted_at;
+				ALTER TABLE appointments DROP COLUMN IF EXISTS deleted_at;
+				ALTER TABLE waiting_patients DROP COLUMN IF EXISTS deleted_at;
+				ALTER TABLE messages DROP COLUMN IF EXISTS deleted_at;
+				ALTER TABLE ordonnances DROP COLUMN IF EXISTS deleted_at;
+				ALTER TABLE payments DROP COLUMN IF EXISTS deleted_at;
+				ALTER TABLE visits DROP COLUMN IF EXISTS deleted_at;
+				ALTER TABLE patients DROP COLUMN IF EXISTS deleted_at;
+			`)
+			return err
+		},
+	}
+}
+
+// PatientBarcodes gives a barcode to the patients imported without one and
+// forbids empty barcodes from then on (version 4)
+func PatientBarcodes() Migration {
+	return Migration{
+		Version:     4,
+		Description: "Backfill empty patient barcodes",
+		Up: func(db *sql.DB) error {
+			count, err := repository.NewPatientRepository(db).BackfillBarcodes()
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				log.Printf("🏷️ Generated barcodes for %d patients", count)
+			}
+
+			_, err = db.Exec(`
+				ALTER TABLE patients DROP CONSTRAINT IF EXISTS patients_barcode_not_empty;
+				ALTER TABLE patients ADD CONSTRAINT patients_barcode_not_empty CHECK (barcode <> '');
+			`)
+			return err
+		},
+		Down: func(db *sql.DB) error {
+			_, err := db.Exec(`ALTER TABLE patients DROP CONSTRAINT IF EXISTS patients_barcode_not_empty`)
+			return err
+		},
+	}
+}
+
+// SyncTracking records which transaction last wrote each row of the synced
+// tables, and which rows were hard-deleted, for delta sync (version 5)
+func SyncTracking() Migration {
+	return Migration{
+		Version:     5,
+		Description: "Track changes for delta sync",
+		Up: func(db *sql.DB) error {
+			statements := []string{`
+				CREATE TABLE IF NOT EXISTS sync_deletions (
+					table_name VARCHAR(64) NOT NULL,
+					row_key BIGINT NOT NULL,
+					sync_txid BIGINT NOT NULL DEFAULT txid_current(),
+					deleted_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+				);
+				CREATE INDEX IF NOT EXISTS idx_sync_deletions_txid ON sync_deletions(sync_txid);
+
+				CREATE OR REPLACE FUNCTION track_sync_change()
+				RETURNS TRIGGER AS $$
+				BEGIN
+					NEW.sync_txid = txid_current();
+					RETURN NEW;
+				END;
+				$$ language 'plpgsql';
+
+				CREATE OR REPLACE FUNCTION track_sync_deletion()
+				RETURNS TRIGGER AS $$
+				BEGIN
+					INSERT INTO sync_deletions (table_name, row_key)
+					VALUES (TG_TABLE_NAME, (to_jsonb(OLD) ->> TG_ARGV[0])::BIGINT);
+					RETURN OLD;
+				END;
+				$$ language 'plpgsql';
+			`}
+			for _, table := range repository.SyncTables {
+				statements = append(statements, fmt.Sprintf(`
+					ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS sync_txid BIGINT NOT NULL DEFAULT 0;
+					CREATE INDEX IF NOT EXISTS idx_%[1]s_sync ON %[1]s(sync_txid);
+					DROP TRIGGER IF EXISTS %[1]s_sync_change ON %[1]s;
+					CREATE TRIGGER %[1]s_sync_change BEFORE INSERT OR UPDATE ON %[1]s
+						FOR EACH ROW EXECUTE FUNCTION track_sync_change();
+					DROP TRIGGER IF EXISTS %[1]s_sync_deletion ON %[1]s;
+					CREATE TRIGGER %[1]s_sync_deletion AFTER DELETE ON %[1]s
+						FOR EACH ROW EXECUTE FUNCTION track_sync_deletion('%[2]s');
+				`, table.Name, table.Key))
+			}
+
+			for _, statement := range statements {
+				if _, err := db.Exec(statement); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(db *sql.DB) error {
+			for _, table := range repository.SyncTables {
+				_, err := db.Exec(fmt.Sprintf(`
+					DROP TRIGGER IF EXISTS %[1]s_sync_deletion ON %[1]s;
+					DROP TRIGGER IF EXISTS %[1]s_sync_change ON %[1]s;
+					DROP INDEX IF EXISTS idx_%[1]s_sync;
+					ALTER TABLE %[1]s DROP COLUMN IF EXISTS sync_txid;
+				`, table.Name))
+				if err != nil {
+					return err
+				}
+			}
+			_, err := db.Exec(`
+				DROP FUNCTION IF EXISTS track_sync_deletion();
+				DROP FUNCTION IF EXISTS track_sync_change();
+				DROP TABLE IF EXISTS sync_deletions;
+			`)
+			return err
+		},
+	}
+}
@@ -38,12 +38,17 @@ func DefaultConfig() Config {
 	}
 }
 
-// NewPostgresConnection creates a new PostgreSQL database connection with connection pooling
-func NewPostgresConnection(cfg Config) (*sql.DB, error) {
-	connStr := fmt.Sprintf(
+// ConnString returns the lib/pq connection string of the configuration
+func (cfg Config) ConnString() string {
+	return fmt.Sprintf(
 		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
 		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName, cfg.SSLMode,
 	)
+}
+
+// NewPostgresConnection creates a new PostgreSQL database connection with connection pooling
+func NewPostgresConnection(cfg Config) (*sql.DB, error) {
+	connStr := cfg.ConnString()
 
 	log.Printf("📊 Connecting to PostgreSQL: %s@%s:%d/%s", cfg.User, cfg.Host, cfg.Port, cfg.DBName)
 
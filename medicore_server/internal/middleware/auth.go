@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -20,8 +21,17 @@ const (
 	UserIDKey ContextKey = "user_id"
 	// UserRoleKey is the context key for user role
 	UserRoleKey ContextKey = "user_role"
+	// SessionTokenKey is the context key for the session token
+	SessionTokenKey ContextKey = "session_token"
 )
 
+// SessionDuration is how long a session token stays valid without refresh
+const SessionDuration = 24 * time.Hour
+
+// ErrInvalidSession is returned for a token that is unknown, expired or of
+// a deleted user. Other session errors mean the database could not answer.
+var ErrInvalidSession = errors.New("invalid or expired session")
+
 // AuthMiddleware provides JWT-like authentication
 type AuthMiddleware struct {
 	db *sql.DB
@@ -42,13 +52,13 @@ func GenerateToken() (string, error) {
 }
 
 // CreateSession creates a new session for a user
-func (a *AuthMiddleware) CreateSession(userID, ipAddress, userAgent string) (string, error) {
+func (a *AuthMiddleware) CreateSession(userID, ipAddress, userAgent string) (string, time.Time, error) {
 	token, err := GenerateToken()
 	if err != nil {
-		return "", fmt.Errorf("failed to generate token: %w", err)
+		return "", time.Time{}, fmt.Errorf("failed to generate token: %w", err)
 	}
 
-	expiresAt := time.Now().Add(24 * time.Hour) // 24 hour session
+	expiresAt := time.Now().Add(SessionDuration)
 
 	_, err = a.db.Exec(`
 		INSERT INTO sessions (user_id, token, ip_address, user_agent, expires_at)
@@ -56,10 +66,29 @@ func (a *AuthMiddleware) CreateSession(userID, ipAddress, userAgent string) (str
 	`, userID, token, ipAddress, userAgent, expiresAt)
 
 	if err != nil {
-		return "", fmt.Errorf("failed to create session: %w", err)
+		return "", time.Time{}, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return token, expiresAt, nil
+}
+
+// RefreshSession replaces a valid session with a new one and returns the new token
+func (a *AuthMiddleware) RefreshSession(token, ipAddress, userAgent string) (string, time.Time, error) {
+	userID, _, err := a.ValidateSession(token)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	newToken, expiresAt, err := a.CreateSession(userID, ipAddress, userAgent)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if err := a.DeleteSession(token); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to revoke old session: %w", err)
 	}
 
-	return token, nil
+	return newToken, expiresAt, nil
 }
 
 // ValidateSession validates a session token
@@ -70,12 +99,12 @@ func (a *AuthMiddleware) ValidateSession(token string) (userID, userRole string,
 		SELECT s.user_id, u.role, s.expires_at
 		FROM sessions s
 		JOIN users u ON s.user_id = u.id
-		WHERE s.token = $1 AND s.expires_at > NOW()
+		WHERE s.token = $1 AND s.expires_at > NOW() AND u.deleted_at IS NULL
 	`, token).Scan(&userID, &userRole, &expiresAt)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return "", "", fmt.Errorf("invalid or expired session")
+			return "", "", ErrInvalidSession
 		}
 		return "", "", fmt.Errorf("session validation failed: %w", err)
 	}
@@ -98,6 +127,22 @@ func (a *AuthMiddleware) DeleteSession(token string) error {
 	return err
 }
 
+// DeleteUserSessions deletes every session of a user
+func (a *AuthMiddleware) DeleteUserSessions(userID string) error {
+	_, err := a.db.Exec(`
+		DELETE FROM sessions WHERE user_id = $1
+	`, userID)
+	return err
+}
+
+// DeleteOtherSessions deletes every session of a user except the given one
+func (a *AuthMiddleware) DeleteOtherSessions(userID, keepToken string) error {
+	_, err := a.db.Exec(`
+		DELETE FROM sessions WHERE user_id = $1 AND token <> $2
+	`, userID, keepToken)
+	return err
+}
+
 // CleanupExpiredSessions removes expired sessions
 func (a *AuthMiddleware) CleanupExpiredSessions() error {
 	result, err := a.db.Exec(`
@@ -118,44 +163,64 @@ func (a *AuthMiddleware) CleanupExpiredSessions() error {
 // Middleware is the HTTP middleware for authentication
 func (a *AuthMiddleware) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Skip auth for certain endpoints
-		if a.shouldSkipAuth(r.URL.Path) {
+		// Skip auth for certain endpoints and CORS preflight requests
+		if r.Method == http.MethodOptions || a.shouldSkipAuth(r.URL.Path) {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		// Get token from Authorization header
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Missing authorization header", http.StatusUnauthorized)
-			return
-		}
-
-		// Extract token (format: "Bearer <token>")
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			http.Error(w, "Invalid authorization header format", http.StatusUnauthorized)
+		token, err := TokenFromRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
 
-		token := parts[1]
-
 		// Validate token
 		userID, userRole, err := a.ValidateSession(token)
-		if err != nil {
+		if errors.Is(err, ErrInvalidSession) {
 			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
 			return
 		}
+		if err != nil {
+			// The session may well be valid: clients must not log out
+			w.Header().Set("Retry-After", "5")
+			http.Error(w, "Session check unavailable, retry later", http.StatusServiceUnavailable)
+			return
+		}
 
 		// Add user info to context
 		ctx := context.WithValue(r.Context(), UserIDKey, userID)
 		ctx = context.WithValue(ctx, UserRoleKey, userRole)
+		ctx = context.WithValue(ctx, SessionTokenKey, token)
 
 		// Continue with authenticated request
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// TokenFromRequest extracts the session token from the Authorization header.
+// The event stream also accepts a "token" query parameter because streaming
+// clients cannot always set headers.
+func TokenFromRequest(r *http.Request) (string, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		if strings.HasPrefix(r.URL.Path, "/api/events") {
+			if token := r.URL.Query().Get("token"); token != "" {
+				return token, nil
+			}
+		}
+		return "", fmt.Errorf("missing authorization header")
+	}
+
+	// Extract token (format: "Bearer <token>")
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" || parts[1] == "" {
+		return "", fmt.Errorf("invalid authorization header format")
+	}
+
+	return parts[1], nil
+}
+
 // shouldSkipAuth determines if a path should skip authentication
 func (a *AuthMiddleware) shouldSkipAuth(path string) bool {
 	skipPaths := []string{
@@ -182,6 +247,14 @@ func GetUserID(r *http.Request) string {
 	return ""
 }
 
+// GetSessionToken extracts the session token from request context
+func GetSessionToken(r *http.Request) string {
+	if token, ok := r.Context().Value(SessionTokenKey).(string); ok {
+		return token
+	}
+	return ""
+}
+
 // GetUserRole extracts user role from request context
 func GetUserRole(r *http.Request) string {
 	if role, ok := r.Context().Value(UserRoleKey).(string); ok {
@@ -190,21 +263,12 @@ func GetUserRole(r *http.Request) string {
 	return ""
 }
 
-// RequireRole middleware to check user role
+// RequireRole middleware to check user role. Allowed roles are role
+// categories (RoleDoctor, RoleNurse...); administrators always pass.
 func RequireRole(allowedRoles ...string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			userRole := GetUserRole(r)
-
-			allowed := false
-			for _, role := range allowedRoles {
-				if userRole == role {
-					allowed = true
-					break
-				}
-			}
-
-			if !allowed {
+			if !HasRole(GetUserRole(r), allowedRoles...) {
 				http.Error(w, "Forbidden: insufficient permissions", http.StatusForbidden)
 				return
 			}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	_ "github.com/lib/pq"
+)
+
+// A database that cannot answer must not log clients out
+func TestMiddlewareAnswers503WhenSessionsCannotBeChecked(t *testing.T) {
+	db, err := sql.Open("postgres", "postgres://localhost/unused?sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	reached := false
+	handler := NewAuthMiddleware(db).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/api/GetAllPatients", nil)
+	r.Header.Set("Authorization", "Bearer some-token")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("got %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("no Retry-After header")
+	}
+	if reached {
+		t.Error("request reached the handler without a session")
+	}
+}
+
+func TestMiddlewareAnswers401WithoutAToken(t *testing.T) {
+	handler := NewAuthMiddleware(nil).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/GetAllPatients", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("got %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordCost is the bcrypt work factor used for new hashes
+const PasswordCost = 12
+
+// HashPassword hashes a plaintext password with bcrypt
+func HashPassword(password string) (string, error) {
+	if password == "" {
+		return "", fmt.Errorf("password must not be empty")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), PasswordCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// IsPasswordHash reports whether a stored value is a bcrypt hash
+// rather than a legacy plaintext password
+func IsPasswordHash(stored string) bool {
+	return len(stored) == 60 &&
+		(strings.HasPrefix(stored, "$2a$") || strings.HasPrefix(stored, "$2b$") || strings.HasPrefix(stored, "$2y$"))
+}
+
+// CheckPassword compares a plaintext password with a stored value.
+// needsRehash is true when the stored value is legacy plaintext (or an
+// outdated bcrypt cost) and should be replaced after a successful match.
+func CheckPassword(stored, password string) (ok bool, needsRehash bool) {
+	if !IsPasswordHash(stored) {
+		// Legacy rows hold the plaintext password
+		ok = stored != "" && subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+		return ok, ok
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) != nil {
+		return false, false
+	}
+
+	cost, err := bcrypt.Cost([]byte(stored))
+	return true, err != nil || cost < PasswordCost
+}
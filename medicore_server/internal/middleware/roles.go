@@ -0,0 +1,60 @@
+package middleware
+
+import "strings"
+
+// Role categories used for authorization. Role names are free text in the
+// users table ("Médecin", "Dr. Martin", "Assistant 1"...), so permissions are
+// checked against the category a role name belongs to.
+const (
+	RoleAdmin     = "admin"
+	RoleDoctor    = "doctor"
+	RoleNurse     = "nurse"
+	RoleAssistant = "assistant"
+)
+
+// RoleCategory maps a stored role name to its category, or "" when unknown.
+// Matching follows the rules used by the desktop client.
+func RoleCategory(role string) string {
+	lower := strings.ToLower(strings.TrimSpace(role))
+	switch {
+	case lower == RoleAdmin || strings.Contains(lower, "administrat"):
+		return RoleAdmin
+	case lower == RoleDoctor || strings.Contains(lower, "docteur") ||
+		strings.Contains(lower, "médecin") || strings.Contains(lower, "medecin") ||
+		strings.HasPrefix(lower, "dr"):
+		return RoleDoctor
+	case lower == RoleNurse || strings.Contains(lower, "infirmi"):
+		return RoleNurse
+	case strings.Contains(lower, RoleAssistant):
+		return RoleAssistant
+	}
+	return ""
+}
+
+// HasRole reports whether a role name belongs to one of the allowed
+// categories. Administrators are always allowed.
+func HasRole(role string, allowedCategories ...string) bool {
+	category := RoleCategory(role)
+	if category == "" {
+		return false
+	}
+	if category == RoleAdmin {
+		return true
+	}
+	for _, allowed := range allowedCategories {
+		if category == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// CanGrantRole reports whether a user may create users with a role name.
+// Administrators may grant any role, other users only their own category.
+func CanGrantRole(grantor, role string) bool {
+	category := RoleCategory(grantor)
+	if category == RoleAdmin {
+		return true
+	}
+	return category != "" && RoleCategory(role) == category
+}
@@ -0,0 +1,19 @@
+package models
+
+// Appointment is a planned visit, possibly for someone who is not a
+// patient yet
+type Appointment struct {
+	ID                  int64      `json:"id"`
+	AppointmentDate     Timestamp  `json:"appointment_date"`
+	FirstName           string     `json:"first_name"`
+	LastName            string     `json:"last_name"`
+	Age                 *int       `json:"age,omitempty"`
+	DateOfBirth         *Timestamp `json:"date_of_birth,omitempty"`
+	PhoneNumber         *string    `json:"phone_number,omitempty"`
+	Address             *string    `json:"address,omitempty"`
+	Notes               *string    `json:"notes,omitempty"`
+	ExistingPatientCode *int       `json:"existing_patient_code,omitempty"`
+	WasAdded            bool       `json:"was_added"`
+	CreatedAt           Timestamp  `json:"created_at"`
+	CreatedBy           *string    `json:"created_by,omitempty"`
+}
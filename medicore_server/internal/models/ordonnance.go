@@ -0,0 +1,18 @@
+package models
+
+// Ordonnance is a prescription or report, holding up to three documents
+type Ordonnance struct {
+	ID           int64   `json:"id"`
+	PatientCode  int     `json:"patient_code"`
+	Sequence     int     `json:"sequence"`
+	DocumentDate *string `json:"document_date,omitempty"`
+	DoctorName   *string `json:"doctor_name,omitempty"`
+	ReportTitle  *string `json:"report_title,omitempty"`
+	ReferredBy   *string `json:"referred_by,omitempty"`
+	Type1        *string `json:"type1,omitempty"`
+	Content1     *string `json:"content1,omitempty"`
+	Type2        *string `json:"type2,omitempty"`
+	Content2     *string `json:"content2,omitempty"`
+	Type3        *string `json:"type3,omitempty"`
+	Content3     *string `json:"content3,omitempty"`
+}
@@ -0,0 +1,15 @@
+package models
+
+// Patient is a row of the patients table as returned to clients
+type Patient struct {
+	Code        int     `json:"code"`
+	Barcode     string  `json:"barcode"`
+	FirstName   string  `json:"first_name"`
+	LastName    string  `json:"last_name"`
+	Age         *int    `json:"age,omitempty"`
+	DateOfBirth *string `json:"date_of_birth,omitempty"`
+	Address     *string `json:"address,omitempty"`
+	Phone       *string `json:"phone,omitempty"`
+	Notes       *string `json:"notes,omitempty"` // other_info column
+	CreatedAt   *string `json:"created_at,omitempty"`
+}
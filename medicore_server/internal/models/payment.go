@@ -0,0 +1,16 @@
+package models
+
+// Payment is a fee collected for a medical act
+type Payment struct {
+	ID               int64  `json:"id"`
+	MedicalActID     int    `json:"medical_act_id"`
+	MedicalActName   string `json:"medical_act_name"`
+	Amount           int    `json:"amount"`
+	UserID           string `json:"user_id"`
+	UserName         string `json:"user_name"`
+	PatientCode      int    `json:"patient_code"`
+	PatientFirstName string `json:"patient_first_name"`
+	PatientLastName  string `json:"patient_last_name"`
+	PaymentTime      string `json:"payment_time"`
+	IsActive         bool   `json:"is_active"`
+}
@@ -0,0 +1,42 @@
+package models
+
+// SurgeryPlan is a scheduled eye surgery
+type SurgeryPlan struct {
+	ID               int64     `json:"id"`
+	SurgeryDate      Timestamp `json:"surgery_date"`
+	SurgeryHour      string    `json:"surgery_hour"`
+	PatientCode      int       `json:"patient_code"`
+	PatientFirstName string    `json:"patient_first_name"`
+	PatientLastName  string    `json:"patient_last_name"`
+	PatientAge       *int      `json:"patient_age,omitempty"`
+	PatientPhone     *string   `json:"patient_phone,omitempty"`
+	SurgeryType      string    `json:"surgery_type"`
+	EyeToOperate     string    `json:"eye_to_operate"` // OD, OG or ODG
+	ImplantPower     *string   `json:"implant_power,omitempty"`
+	Tarif            *int      `json:"tarif,omitempty"`
+	PaymentStatus    string    `json:"payment_status"` // pending, partial or paid
+	AmountRemaining  *int      `json:"amount_remaining,omitempty"`
+	SurgeryStatus    string    `json:"surgery_status"` // scheduled, done or cancelled
+	PatientCame      bool      `json:"patient_came"`
+	Notes            *string   `json:"notes,omitempty"`
+	CreatedAt        Timestamp `json:"created_at"`
+	CreatedBy        *string   `json:"created_by,omitempty"`
+	UpdatedAt        Timestamp `json:"updated_at"`
+	NeedsSync        bool      `json:"needs_sync"`
+}
+
+// SurgeryPlanChanges lists the fields of a surgery plan to update.
+// Nil fields are left unchanged.
+type SurgeryPlanChanges struct {
+	SurgeryDate     *Timestamp `json:"surgery_date"`
+	SurgeryHour     *string    `json:"surgery_hour"`
+	SurgeryType     *string    `json:"surgery_type"`
+	EyeToOperate    *string    `json:"eye_to_operate"`
+	ImplantPower    *string    `json:"implant_power"`
+	Tarif           *int       `json:"tarif"`
+	PaymentStatus   *string    `json:"payment_status"`
+	AmountRemaining *int       `json:"amount_remaining"`
+	SurgeryStatus   *string    `json:"surgery_status"`
+	PatientCame     *bool      `json:"patient_came"`
+	Notes           *string    `json:"notes"`
+}
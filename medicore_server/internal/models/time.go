@@ -0,0 +1,94 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// timeLayouts are the date formats accepted from clients. Dart's
+// toIso8601String() omits the zone, so local times are accepted too.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// ParseTime parses a client date in any of the accepted formats.
+// Dates without a zone are read in the server's local time.
+func ParseTime(value string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
+
+// Timestamp is a time serialized as RFC3339, the format the clients expect.
+// It scans NULL as the zero time. A value that is not a date is kept aside
+// instead of failing the whole decoding, so validation can report it
+// against its field.
+type Timestamp struct {
+	time.Time
+	invalid string
+}
+
+// NewTimestamp wraps a time
+func NewTimestamp(t time.Time) Timestamp {
+	return Timestamp{Time: t}
+}
+
+// Invalid reports whether the client sent a value that is not a date
+func (t Timestamp) Invalid() bool {
+	return t.invalid != ""
+}
+
+// MarshalJSON implements json.Marshaler
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Format(time.RFC3339))
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	*t = Timestamp{}
+	if string(data) == "null" {
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.invalid = string(data)
+		return nil
+	}
+	if s == "" {
+		return nil
+	}
+	parsed, err := ParseTime(s)
+	if err != nil {
+		t.invalid = s
+		return nil
+	}
+	t.Time = parsed
+	return nil
+}
+
+// Scan implements sql.Scanner
+func (t *Timestamp) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		t.Time = time.Time{}
+	case time.Time:
+		t.Time = v
+	default:
+		return fmt.Errorf("cannot scan %T into Timestamp", src)
+	}
+	return nil
+}
+
+// Value implements driver.Valuer
+func (t Timestamp) Value() (driver.Value, error) {
+	return t.Time, nil
+}
@@ -0,0 +1,60 @@
+package models
+
+// Visit is a consultation with the refraction and exam results of both eyes
+// (OD = right eye, OG = left eye)
+type Visit struct {
+	ID            int64   `json:"id"`
+	PatientCode   int     `json:"patient_code"`
+	VisitSequence int     `json:"visit_sequence"`
+	VisitDate     string  `json:"visit_date"`
+	DoctorName    *string `json:"doctor_name,omitempty"`
+	Motif         *string `json:"motif,omitempty"`
+	Diagnosis     *string `json:"diagnosis,omitempty"`
+	Conduct       *string `json:"conduct,omitempty"`
+
+	// Right eye
+	OdSv       *string `json:"od_sv,omitempty"`
+	OdAv       *string `json:"od_av,omitempty"`
+	OdSphere   *string `json:"od_sphere,omitempty"`
+	OdCylinder *string `json:"od_cylinder,omitempty"`
+	OdAxis     *string `json:"od_axis,omitempty"`
+	OdVl       *string `json:"od_vl,omitempty"`
+	OdK1       *string `json:"od_k1,omitempty"`
+	OdK2       *string `json:"od_k2,omitempty"`
+	OdR1       *string `json:"od_r1,omitempty"`
+	OdR2       *string `json:"od_r2,omitempty"`
+	OdR0       *string `json:"od_r0,omitempty"`
+	OdPachy    *string `json:"od_pachy,omitempty"`
+	OdToc      *string `json:"od_toc,omitempty"`
+	OdNotes    *string `json:"od_notes,omitempty"`
+	OdGonio    *string `json:"od_gonio,omitempty"`
+	OdTo       *string `json:"od_to,omitempty"`
+	OdLaf      *string `json:"od_laf,omitempty"`
+	OdFo       *string `json:"od_fo,omitempty"`
+
+	// Left eye
+	OgSv       *string `json:"og_sv,omitempty"`
+	OgAv       *string `json:"og_av,omitempty"`
+	OgSphere   *string `json:"og_sphere,omitempty"`
+	OgCylinder *string `json:"og_cylinder,omitempty"`
+	OgAxis     *string `json:"og_axis,omitempty"`
+	OgVl       *string `json:"og_vl,omitempty"`
+	OgK1       *string `json:"og_k1,omitempty"`
+	OgK2       *string `json:"og_k2,omitempty"`
+	OgR1       *string `json:"og_r1,omitempty"`
+	OgR2       *string `json:"og_r2,omitempty"`
+	OgR0       *string `json:"og_r0,omitempty"`
+	OgPachy    *string `json:"og_pachy,omitempty"`
+	OgToc      *string `json:"og_toc,omitempty"`
+	OgNotes    *string `json:"og_notes,omitempty"`
+	OgGonio    *string `json:"og_gonio,omitempty"`
+	OgTo       *string `json:"og_to,omitempty"`
+	OgLaf      *string `json:"og_laf,omitempty"`
+	OgFo       *string `json:"og_fo,omitempty"`
+
+	// Shared
+	Addition *string `json:"addition,omitempty"`
+	Dip      *string `json:"dip,omitempty"`
+
+	CreatedAt *string `json:"created_at"`
+}
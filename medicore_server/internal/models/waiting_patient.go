@@ -0,0 +1,22 @@
+package models
+
+// WaitingPatient is an entry of a room's waiting queue
+type WaitingPatient struct {
+	ID               int64   `json:"id"`
+	PatientCode      int     `json:"patient_code"`
+	PatientFirstName string  `json:"patient_first_name"`
+	PatientLastName  string  `json:"patient_last_name"`
+	PatientAge       *int    `json:"patient_age,omitempty"`
+	IsUrgent         bool    `json:"is_urgent"`
+	IsDilatation     bool    `json:"is_dilatation"`
+	DilatationType   *string `json:"dilatation_type,omitempty"`
+	RoomID           string  `json:"room_id"`
+	RoomName         string  `json:"room_name"`
+	Motif            string  `json:"motif"`
+	SentByUserID     string  `json:"sent_by_user_id"`
+	SentByUserName   string  `json:"sent_by_user_name"`
+	SentAt           string  `json:"sent_at"`
+	IsChecked        bool    `json:"is_checked"`
+	IsActive         bool    `json:"is_active"`
+	IsNotified       bool    `json:"is_notified"`
+}
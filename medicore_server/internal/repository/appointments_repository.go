@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"time"
+
+	"medicore/internal/models"
+)
+
+const appointmentColumns = `id, appointment_date, first_name, last_name, age, date_of_birth, 
+	       phone_number, address, notes, existing_patient_code, was_added, created_at, created_by`
+
+// AppointmentRepository reads and writes the appointments table
+type AppointmentRepository struct {
+	db DBTX
+}
+
+// NewAppointmentRepository creates an appointment repository
+func NewAppointmentRepository(db DBTX) *AppointmentRepository {
+	return &AppointmentRepository{db: db}
+}
+
+func (r *AppointmentRepository) list(query string, args ...interface{}) ([]models.Appointment, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	appointments := []models.Appointment{}
+	for rows.Next() {
+		var a models.Appointment
+		if err := rows.Scan(&a.ID, &a.AppointmentDate, &a.FirstName, &a.LastName, &a.Age, &a.DateOfBirth,
+			&a.PhoneNumber, &a.Address, &a.Notes, &a.ExistingPatientCode, &a.WasAdded, &a.CreatedAt, &a.CreatedBy); err != nil {
+			return nil, err
+		}
+		appointments = append(appointments, a)
+	}
+	return appointments, rows.Err()
+}
+
+// GetForDate returns the appointments of a day, by last name
+func (r *AppointmentRepository) GetForDate(date time.Time) ([]models.Appointment, error) {
+	startOfDay := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.Local)
+	endOfDay := time.Date(date.Year(), date.Month(), date.Day(), 23, 59, 59, 0, time.Local)
+
+	return r.list(`
+		SELECT `+appointmentColumns+`
+		FROM appointments 
+		WHERE appointment_date BETWEEN $1 AND $2 AND deleted_at IS NULL
+		ORDER BY last_name
+	`, startOfDay, endOfDay)
+}
+
+// GetAll returns every appointment by date
+func (r *AppointmentRepository) GetAll() ([]models.Appointment, error) {
+	return r.list(`
+		SELECT ` + appointmentColumns + `
+		FROM appointments 
+		WHERE deleted_at IS NULL
+		ORDER BY appointment_date
+	`)
+}
+
+// ChangedSince returns the appointments written by the transactions from
+// fromTxid up to toTxid (excluded) that are not deleted
+func (r *AppointmentRepository) ChangedSince(fromTxid, toTxid int64) ([]models.Appointment, error) {
+	return r.list(`
+		SELECT `+appointmentColumns+`
+		FROM appointments WHERE sync_txid >= $1 AND sync_txid < $2 AND deleted_at IS NULL ORDER BY id
+	`, fromTxid, toTxid)
+}
+
+// Create inserts an appointment and returns its id
+func (r *AppointmentRepository) Create(a *models.Appointment) (int64, error) {
+	var id int64
+	err := r.db.QueryRow(`
+		INSERT INTO appointments (appointment_date, first_name, last_name, age, date_of_birth, 
+		                          phone_number, address, notes, existing_patient_code, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id
+	`, a.AppointmentDate, a.FirstName, a.LastName, a.Age, a.DateOfBirth, a.PhoneNumber, a.Address, a.Notes,
+		a.ExistingPatientCode, a.CreatedBy, time.Now()).Scan(&id)
+	return id, err
+}
+
+// UpdateDate moves an appointment to another date
+func (r *AppointmentRepository) UpdateDate(id int64, date time.Time) error {
+	_, err := r.db.Exec(`UPDATE appointments SET appointment_date = $1 WHERE id = $2`, date, id)
+	return err
+}
+
+// MarkAsAdded records that the appointment was turned into a patient
+func (r *AppointmentRepository) MarkAsAdded(id int64) error {
+	_, err := r.db.Exec(`UPDATE appointments SET was_added = TRUE WHERE id = $1`, id)
+	return err
+}
+
+// Delete removes an appointment
+func (r *AppointmentRepository) Delete(id int64) error {
+	_, err := r.db.Exec(`DELETE FROM appointments WHERE id = $1`, id)
+	return err
+}
+
+// DeletePastNotAdded removes the appointments before today that were never
+// turned into patients, and returns how many were deleted
+func (r *AppointmentRepository) DeletePastNotAdded() (int64, error) {
+	now := time.Now()
+	startOfToday := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+
+	result, err := r.db.Exec(`DELETE FROM appointments WHERE appointment_date < $1 AND was_added = FALSE`, startOfToday)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
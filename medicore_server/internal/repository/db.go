@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// ErrNotFound is returned when a lookup by key matches no row
+var ErrNotFound = errors.New("not found")
+
+// DBTX is the part of *sql.DB and *sql.Tx used by repositories, so the
+// same repository can run inside or outside a transaction
+type DBTX interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// scanner is implemented by *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// notFound maps sql.ErrNoRows to ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// updatedOne maps an update or delete matching no row to ErrNotFound
+func updatedOne(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// InTx runs fn inside a transaction, committing when it returns nil and
+// rolling back otherwise
+func InTx(db *sql.DB, fn func(tx DBTX) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"medicore/internal/models"
+)
+
+const ordonnanceColumns = `id, patient_code, sequence, document_date, doctor_name, report_title, referred_by,
+	       type1, content1, type2, content2, type3, content3`
+
+// OrdonnanceRepository reads and writes the ordonnances table
+type OrdonnanceRepository struct {
+	db DBTX
+}
+
+// NewOrdonnanceRepository creates an ordonnance repository
+func NewOrdonnanceRepository(db DBTX) *OrdonnanceRepository {
+	return &OrdonnanceRepository{db: db}
+}
+
+func (r *OrdonnanceRepository) list(query string, args ...interface{}) ([]models.Ordonnance, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ordonnances := []models.Ordonnance{}
+	for rows.Next() {
+		var o models.Ordonnance
+		if err := rows.Scan(&o.ID, &o.PatientCode, &o.Sequence, &o.DocumentDate, &o.DoctorName, &o.ReportTitle, &o.ReferredBy,
+			&o.Type1, &o.Content1, &o.Type2, &o.Content2, &o.Type3, &o.Content3); err != nil {
+			return nil, err
+		}
+		ordonnances = append(ordonnances, o)
+	}
+	return ordonnances, rows.Err()
+}
+
+// GetForPatient returns the documents of a patient, most recent first
+func (r *OrdonnanceRepository) GetForPatient(patientCode int) ([]models.Ordonnance, error) {
+	return r.list(`
+		SELECT `+ordonnanceColumns+`
+		FROM ordonnances WHERE patient_code = $1 AND deleted_at IS NULL ORDER BY document_date DESC, id DESC
+	`, patientCode)
+}
+
+// ChangedSince returns the documents written by the transactions from
+// fromTxid up to toTxid (excluded) that are not deleted
+func (r *OrdonnanceRepository) ChangedSince(fromTxid, toTxid int64) ([]models.Ordonnance, error) {
+	return r.list(`
+		SELECT `+ordonnanceColumns+`
+		FROM ordonnances WHERE sync_txid >= $1 AND sync_txid < $2 AND deleted_at IS NULL ORDER BY id
+	`, fromTxid, toTxid)
+}
+
+// Create inserts a document and returns its id
+func (r *OrdonnanceRepository) Create(o *models.Ordonnance) (int64, error) {
+	var id int64
+	err := r.db.QueryRow(`
+		INSERT INTO ordonnances (patient_code, sequence, document_date, doctor_name, report_title, type1, content1)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`, o.PatientCode, o.Sequence, o.DocumentDate, o.DoctorName, o.ReportTitle, o.Type1, o.Content1).Scan(&id)
+	return id, err
+}
+
+// Update changes the first document of an ordonnance. It returns
+// ErrNotFound if there is no ordonnance with this id or it is deleted.
+func (r *OrdonnanceRepository) Update(o *models.Ordonnance) error {
+	return updatedOne(r.db.Exec(`UPDATE ordonnances SET content1 = $1, type1 = $2 WHERE id = $3 AND deleted_at IS NULL`, o.Content1, o.Type1, o.ID))
+}
+
+// Delete soft-deletes an ordonnance. It returns ErrNotFound if there is no
+// ordonnance with this id or it is already deleted. Restoring its patient
+// does not bring it back.
+func (r *OrdonnanceRepository) Delete(id int64) error {
+	return updatedOne(r.db.Exec(`UPDATE ordonnances SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`, id))
+}
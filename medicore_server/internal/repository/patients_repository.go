@@ -0,0 +1,378 @@
+package repository
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"medicore/internal/models"
+)
+
+// ErrBarcodeTaken is returned when a barcode given for a new patient already
+// belongs to another patient
+var ErrBarcodeTaken = errors.New("barcode already in use")
+
+var errBarcodeExhausted = errors.New("could not generate a unique barcode")
+
+const (
+	barcodeChars    = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789+"
+	barcodeLength   = 8
+	barcodeAttempts = 10
+)
+
+// NewBarcode returns a random 8-character patient barcode
+func NewBarcode() (string, error) {
+	b := make([]byte, barcodeLength)
+	max := big.NewInt(int64(len(barcodeChars)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate barcode: %w", err)
+		}
+		b[i] = barcodeChars[n.Int64()]
+	}
+	return string(b), nil
+}
+
+// isBarcodeConflict reports whether err is a unique violation on the
+// patients barcode
+func isBarcodeConflict(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "patients_barcode_key"
+}
+
+const patientColumns = `code, barcode, first_name, last_name, age, date_of_birth, address, phone_number, other_info, created_at`
+
+// PatientRepository reads and writes the patients table
+type PatientRepository struct {
+	db DBTX
+}
+
+// NewPatientRepository creates a patient repository
+func NewPatientRepository(db DBTX) *PatientRepository {
+	return &PatientRepository{db: db}
+}
+
+func scanPatient(row scanner) (*models.Patient, error) {
+	var p models.Patient
+	err := row.Scan(&p.Code, &p.Barcode, &p.FirstName, &p.LastName, &p.Age, &p.DateOfBirth,
+		&p.Address, &p.Phone, &p.Notes, &p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *PatientRepository) list(query string, args ...interface{}) ([]models.Patient, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	patients := []models.Patient{}
+	for rows.Next() {
+		p, err := scanPatient(rows)
+		if err != nil {
+			return nil, err
+		}
+		patients = append(patients, *p)
+	}
+	return patients, rows.Err()
+}
+
+// GetAll returns every patient, newest first
+func (r *PatientRepository) GetAll() ([]models.Patient, error) {
+	return r.list(`
+		SELECT ` + patientColumns + `
+		FROM patients WHERE deleted_at IS NULL ORDER BY COALESCE(created_at, '1970-01-01') DESC, code DESC
+	`)
+}
+
+// ChangedSince returns the patients written by the transactions from
+// fromTxid up to toTxid (excluded) that are not deleted
+func (r *PatientRepository) ChangedSince(fromTxid, toTxid int64) ([]models.Patient, error) {
+	return r.list(`
+		SELECT `+patientColumns+`
+		FROM patients WHERE sync_txid >= $1 AND sync_txid < $2 AND deleted_at IS NULL ORDER BY code
+	`, fromTxid, toTxid)
+}
+
+// GetByCode returns a patient by code
+func (r *PatientRepository) GetByCode(code int) (*models.Patient, error) {
+	p, err := scanPatient(r.db.QueryRow(`SELECT `+patientColumns+` FROM patients WHERE code = $1 AND deleted_at IS NULL`, code))
+	return p, notFound(err)
+}
+
+// GetByBarcode returns a patient by the barcode printed on their card
+func (r *PatientRepository) GetByBarcode(barcode string) (*models.Patient, error) {
+	p, err := scanPatient(r.db.QueryRow(`SELECT `+patientColumns+` FROM patients WHERE barcode = $1 AND deleted_at IS NULL`, barcode))
+	return p, notFound(err)
+}
+
+// Search finds patients by code (numeric query) or by first and last name
+func (r *PatientRepository) Search(query string) ([]models.Patient, error) {
+	queryStr := strings.TrimSpace(query)
+	queryLower := strings.ToLower(queryStr)
+
+	// Check if query is a number (code search)
+	if code, parseErr := strconv.Atoi(queryStr); parseErr == nil {
+		// Exact code match
+		return r.list(`
+			SELECT `+patientColumns+`
+			FROM patients WHERE code = $1 AND deleted_at IS NULL
+			ORDER BY code ASC
+		`, code)
+	}
+
+	if strings.Contains(queryLower, " ") {
+		// Space-separated: search both first AND last name (either order)
+		parts := strings.SplitN(queryLower, " ", 2)
+		part1 := "%" + parts[0] + "%"
+		part2 := "%" + parts[1] + "%"
+		return r.list(`
+			SELECT `+patientColumns+`
+			FROM patients 
+			WHERE deleted_at IS NULL
+			  AND ((LOWER(first_name) LIKE $1 AND LOWER(last_name) LIKE $2)
+			   OR (LOWER(first_name) LIKE $3 AND LOWER(last_name) LIKE $4))
+			ORDER BY code ASC LIMIT 100
+		`, part1, part2, part2, part1)
+	}
+
+	// Single word: search in first OR last name
+	queryPattern := "%" + queryLower + "%"
+	return r.list(`
+		SELECT `+patientColumns+`
+		FROM patients 
+		WHERE deleted_at IS NULL AND (LOWER(first_name) LIKE $1 OR LOWER(last_name) LIKE $1)
+		ORDER BY code ASC LIMIT 100
+	`, queryPattern)
+}
+
+// NextCode allocates the next patient code from the highest_patient_code
+// counter. Call it in the transaction inserting the patient: the counter row
+// stays locked until that transaction ends, so concurrent creates never get
+// the same code. Codes are never reused, even after a patient is purged.
+func (r *PatientRepository) NextCode() (int, error) {
+	// Codes inserted explicitly (imports, legacy clients) may be above the
+	// counter, so never hand out less than MAX(code) + 1
+	var code int
+	err := r.db.QueryRow(`
+		INSERT INTO app_metadata (key, value_int, updated_at)
+		VALUES ('highest_patient_code', (SELECT COALESCE(MAX(code), 0) + 1 FROM patients), NOW())
+		ON CONFLICT (key) DO UPDATE SET
+			value_int = GREATEST(COALESCE(app_metadata.value_int, 0), (SELECT COALESCE(MAX(code), 0) FROM patients)) + 1,
+			updated_at = NOW()
+		RETURNING value_int
+	`).Scan(&code)
+	return code, err
+}
+
+// Create inserts a new patient. A missing barcode is generated, drawing a
+// new one on the rare collision with an existing barcode; a barcode chosen
+// by the caller that is already taken fails with ErrBarcodeTaken.
+func (r *PatientRepository) Create(p *models.Patient) error {
+	generate := p.Barcode == ""
+	for attempt := 0; attempt < barcodeAttempts; attempt++ {
+		if generate {
+			barcode, err := NewBarcode()
+			if err != nil {
+				return err
+			}
+			p.Barcode = barcode
+		}
+
+		// ON CONFLICT instead of a unique violation, so the transaction
+		// stays usable for another attempt
+		var code int
+		err := r.db.QueryRow(`
+			INSERT INTO patients (code, barcode, first_name, last_name, age, date_of_birth, address, phone_number, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW())
+			ON CONFLICT (barcode) DO NOTHING
+			RETURNING code
+		`, p.Code, p.Barcode, p.FirstName, p.LastName, p.Age, p.DateOfBirth, p.Address, p.Phone).Scan(&code)
+		if err != sql.ErrNoRows {
+			return err
+		}
+		if !generate {
+			return ErrBarcodeTaken
+		}
+	}
+	return errBarcodeExhausted
+}
+
+// Update changes the identity and contact details of a patient. It returns
+// ErrNotFound if there is no live patient with this code.
+func (r *PatientRepository) Update(p *models.Patient) error {
+	result, err := r.db.Exec(`
+		UPDATE patients SET first_name = $1, last_name = $2, age = $3, date_of_birth = $4, address = $5, phone_number = $6, updated_at = NOW()
+		WHERE code = $7 AND deleted_at IS NULL
+	`, p.FirstName, p.LastName, p.Age, p.DateOfBirth, p.Address, p.Phone, p.Code)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Import inserts a patient from a legacy export, or overwrites it if the
+// code already exists. New patients get a generated barcode; existing ones
+// keep theirs.
+func (r *PatientRepository) Import(p *models.Patient) error {
+	for attempt := 0; attempt < barcodeAttempts; attempt++ {
+		barcode, err := NewBarcode()
+		if err != nil {
+			return err
+		}
+
+		_, err = r.db.Exec(`
+			INSERT INTO patients (code, barcode, first_name, last_name, age, date_of_birth, address, phone_number, other_info, created_at, updated_at, needs_sync)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW(), NOW(), TRUE)
+			ON CONFLICT(code) DO UPDATE SET
+				first_name = excluded.first_name,
+				last_name = excluded.last_name,
+				age = excluded.age,
+				date_of_birth = excluded.date_of_birth,
+				address = excluded.address,
+				phone_number = excluded.phone_number,
+				other_info = excluded.other_info,
+				updated_at = NOW()
+		`, p.Code, barcode, p.FirstName, p.LastName, p.Age, p.DateOfBirth, p.Address, p.Phone, p.Notes)
+		if !isBarcodeConflict(err) {
+			return err
+		}
+	}
+	return errBarcodeExhausted
+}
+
+// BackfillBarcodes gives a generated barcode to every patient without one
+// and returns how many were updated
+func (r *PatientRepository) BackfillBarcodes() (int, error) {
+	rows, err := r.db.Query(`SELECT code FROM patients WHERE barcode IS NULL OR barcode = ''`)
+	if err != nil {
+		return 0, err
+	}
+	codes := []int{}
+	for rows.Next() {
+		var code int
+		if err := rows.Scan(&code); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		codes = append(codes, code)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, code := range codes {
+		assigned := false
+		for attempt := 0; attempt < barcodeAttempts && !assigned; attempt++ {
+			barcode, err := NewBarcode()
+			if err != nil {
+				return 0, err
+			}
+			_, err = r.db.Exec(`UPDATE patients SET barcode = $1, updated_at = NOW() WHERE code = $2`, barcode, code)
+			if err != nil && !isBarcodeConflict(err) {
+				return 0, err
+			}
+			assigned = err == nil
+		}
+		if !assigned {
+			return 0, errBarcodeExhausted
+		}
+	}
+	return len(codes), nil
+}
+
+// patientDependents lists the tables holding rows of a patient and the
+// column referencing it. They are deleted, restored and purged along with
+// the patient.
+var patientDependents = []struct{ table, column string }{
+	{"visits", "patient_code"},
+	{"payments", "patient_code"},
+	{"ordonnances", "patient_code"},
+	{"messages", "patient_code"},
+	{"waiting_patients", "patient_code"},
+	{"appointments", "existing_patient_code"},
+	{"surgery_plans", "patient_code"},
+}
+
+// Delete soft-deletes a patient and all of its related data. Run it in a
+// transaction so a failure leaves nothing half deleted: every row then
+// shares the same deleted_at, which is how Restore finds them.
+func (r *PatientRepository) Delete(code int) error {
+	result, err := r.db.Exec(`UPDATE patients SET deleted_at = NOW(), updated_at = NOW() WHERE code = $1 AND deleted_at IS NULL`, code)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+
+	for _, dep := range patientDependents {
+		_, err := r.db.Exec(`UPDATE `+dep.table+` SET deleted_at = NOW() WHERE `+dep.column+` = $1 AND deleted_at IS NULL`, code)
+		if err != nil {
+			return fmt.Errorf("delete %s of patient %d: %w", dep.table, code, err)
+		}
+	}
+	return nil
+}
+
+// Restore brings back a deleted patient with the related data deleted
+// along with it. Rows deleted on their own before that stay deleted.
+func (r *PatientRepository) Restore(code int) error {
+	var deletedAt time.Time
+	err := r.db.QueryRow(`SELECT deleted_at FROM patients WHERE code = $1 AND deleted_at IS NOT NULL`, code).Scan(&deletedAt)
+	if err != nil {
+		return notFound(err)
+	}
+
+	for _, dep := range patientDependents {
+		_, err := r.db.Exec(`UPDATE `+dep.table+` SET deleted_at = NULL WHERE `+dep.column+` = $1 AND deleted_at = $2`, code, deletedAt)
+		if err != nil {
+			return fmt.Errorf("restore %s of patient %d: %w", dep.table, code, err)
+		}
+	}
+
+	_, err = r.db.Exec(`UPDATE patients SET deleted_at = NULL, updated_at = NOW() WHERE code = $1`, code)
+	return err
+}
+
+// Purge permanently removes the patients deleted before a time, with all
+// of their related data, and returns the codes of the removed patients
+func (r *PatientRepository) Purge(before time.Time) ([]int, error) {
+	for _, dep := range patientDependents {
+		_, err := r.db.Exec(`DELETE FROM `+dep.table+` WHERE `+dep.column+` IN (SELECT code FROM patients WHERE deleted_at < $1)`, before)
+		if err != nil {
+			return nil, fmt.Errorf("purge %s: %w", dep.table, err)
+		}
+	}
+
+	rows, err := r.db.Query(`DELETE FROM patients WHERE deleted_at < $1 RETURNING code`, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	codes := []int{}
+	for rows.Next() {
+		var code int
+		if err := rows.Scan(&code); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, rows.Err()
+}
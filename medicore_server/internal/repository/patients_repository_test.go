@@ -0,0 +1,91 @@
+package repository_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"medicore/internal/models"
+	"medicore/internal/repository"
+	"medicore/internal/testdb"
+)
+
+// createPatient allocates a code and inserts a patient in one transaction,
+// as CreatePatient does
+func createPatient(db repository.DBTX, p *models.Patient) error {
+	patients := repository.NewPatientRepository(db)
+	code, err := patients.NextCode()
+	if err != nil {
+		return err
+	}
+	p.Code = code
+	return patients.Create(p)
+}
+
+func TestNextCodeIsUniqueUnderConcurrency(t *testing.T) {
+	db := testdb.New(t)
+	db.SetMaxOpenConns(20)
+
+	const n = 50
+	codes := make([]int, n)
+	errs := make([]error, n)
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			p := &models.Patient{FirstName: fmt.Sprintf("Patient %d", i), LastName: "Concurrent"}
+			errs[i] = repository.InTx(db, func(tx repository.DBTX) error {
+				return createPatient(tx, p)
+			})
+			codes[i] = p.Code
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	seen := map[int]int{}
+	for i, code := range codes {
+		if errs[i] != nil {
+			t.Fatalf("patient %d: %v", i, errs[i])
+		}
+		if other, ok := seen[code]; ok {
+			t.Errorf("patients %d and %d both got code %d", other, i, code)
+		}
+		seen[code] = i
+	}
+
+	var stored int
+	if err := db.QueryRow(`SELECT COUNT(DISTINCT code) FROM patients WHERE last_name = 'Concurrent'`).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored != n {
+		t.Errorf("%d distinct codes stored, want %d", stored, n)
+	}
+}
+
+// Codes inserted explicitly must not be handed out again
+func TestNextCodeSkipsImportedCodes(t *testing.T) {
+	db := testdb.New(t)
+	patients := repository.NewPatientRepository(db)
+
+	first := &models.Patient{FirstName: "First", LastName: "Patient"}
+	if err := createPatient(db, first); err != nil {
+		t.Fatal(err)
+	}
+	imported := &models.Patient{Code: first.Code + 100, FirstName: "Imported", LastName: "Patient"}
+	if err := patients.Import(imported); err != nil {
+		t.Fatal(err)
+	}
+
+	next, err := patients.NextCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next <= imported.Code {
+		t.Errorf("next code %d, want more than %d", next, imported.Code)
+	}
+}
@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"database/sql"
+
+	"medicore/internal/models"
+)
+
+// PaymentRepository reads and writes the payments table
+type PaymentRepository struct {
+	db DBTX
+}
+
+// NewPaymentRepository creates a payment repository
+func NewPaymentRepository(db DBTX) *PaymentRepository {
+	return &PaymentRepository{db: db}
+}
+
+func (r *PaymentRepository) list(query string, args ...interface{}) ([]models.Payment, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payments := []models.Payment{}
+	for rows.Next() {
+		var p models.Payment
+		var paymentTime sql.NullString
+		if err := rows.Scan(&p.ID, &p.MedicalActID, &p.MedicalActName, &p.Amount, &p.UserID, &p.UserName,
+			&p.PatientCode, &p.PatientFirstName, &p.PatientLastName, &paymentTime, &p.IsActive); err != nil {
+			return nil, err
+		}
+		p.PaymentTime = paymentTime.String
+		payments = append(payments, p)
+	}
+	return payments, rows.Err()
+}
+
+// GetForPatient returns the payments of a patient, most recent first
+func (r *PaymentRepository) GetForPatient(patientCode int) ([]models.Payment, error) {
+	// Include old payments that might have NULL is_active (not explicitly deleted)
+	return r.list(`
+		SELECT id, medical_act_id, medical_act_name, amount, user_id, user_name,
+			   patient_code, patient_first_name, patient_last_name, payment_time, COALESCE(is_active, TRUE) as is_active
+		FROM payments WHERE patient_code = $1 AND (is_active = TRUE OR is_active IS NULL) AND deleted_at IS NULL ORDER BY payment_time DESC
+	`, patientCode)
+}
+
+// GetByUserAndDate returns the payments collected by a user on a day
+// (YYYY-MM-DD)
+func (r *PaymentRepository) GetByUserAndDate(userName, date string) ([]models.Payment, error) {
+	// Include old payments that might have NULL is_active (not explicitly deleted)
+	return r.list(`
+		SELECT id, medical_act_id, medical_act_name, amount, user_id, user_name,
+			   patient_code, patient_first_name, patient_last_name, payment_time, COALESCE(is_active, TRUE) as is_active
+		FROM payments 
+		WHERE user_name = $1 
+		  AND (is_active = TRUE OR is_active IS NULL)
+		  AND deleted_at IS NULL
+		  AND payment_time::date = $2::date
+		ORDER BY payment_time ASC
+	`, userName, date)
+}
+
+// GetAllByUser returns every payment collected by a user, most recent first
+func (r *PaymentRepository) GetAllByUser(userName string) ([]models.Payment, error) {
+	// Include old payments that might have NULL or missing is_active (not explicitly deleted)
+	return r.list(`
+		SELECT id, medical_act_id, medical_act_name, amount, user_id, user_name,
+			   patient_code, patient_first_name, patient_last_name, payment_time, COALESCE(is_active, TRUE) as is_active
+		FROM payments WHERE user_name = $1 AND (is_active = TRUE OR is_active IS NULL) AND deleted_at IS NULL ORDER BY payment_time DESC
+	`, userName)
+}
+
+// ChangedSince returns the payments written by the transactions from
+// fromTxid up to toTxid (excluded) that are not deleted or cancelled
+func (r *PaymentRepository) ChangedSince(fromTxid, toTxid int64) ([]models.Payment, error) {
+	return r.list(`
+		SELECT id, medical_act_id, medical_act_name, amount, user_id, user_name,
+			   patient_code, patient_first_name, patient_last_name, payment_time, COALESCE(is_active, TRUE) as is_active
+		FROM payments
+		WHERE sync_txid >= $1 AND sync_txid < $2 AND (is_active = TRUE OR is_active IS NULL) AND deleted_at IS NULL
+		ORDER BY id
+	`, fromTxid, toTxid)
+}
+
+// GetByID returns an active payment by id
+func (r *PaymentRepository) GetByID(id int64) (*models.Payment, error) {
+	var p models.Payment
+	err := r.db.QueryRow(`SELECT id, medical_act_id, medical_act_name, amount, user_id, user_name, patient_code, patient_first_name, patient_last_name, payment_time FROM payments WHERE id = $1 AND is_active = TRUE AND deleted_at IS NULL`, id).
+		Scan(&p.ID, &p.MedicalActID, &p.MedicalActName, &p.Amount, &p.UserID, &p.UserName, &p.PatientCode, &p.PatientFirstName, &p.PatientLastName, &p.PaymentTime)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	p.IsActive = true
+	return &p, nil
+}
+
+// Create inserts a payment and returns its id
+func (r *PaymentRepository) Create(p *models.Payment) (int64, error) {
+	var id int64
+	err := r.db.QueryRow(`
+		INSERT INTO payments (medical_act_id, medical_act_name, amount, user_id, user_name, patient_code, patient_first_name, patient_last_name, payment_time, created_at, updated_at, needs_sync, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW(), NOW(), TRUE, TRUE)
+		RETURNING id
+	`, p.MedicalActID, p.MedicalActName, p.Amount, p.UserID, p.UserName, p.PatientCode, p.PatientFirstName, p.PatientLastName, p.PaymentTime).Scan(&id)
+	return id, err
+}
+
+// Update changes a payment. The collecting user cannot be changed. It
+// returns ErrNotFound if there is no payment with this id or its patient
+// is deleted.
+func (r *PaymentRepository) Update(p *models.Payment) error {
+	return updatedOne(r.db.Exec(`UPDATE payments SET medical_act_id = $1, medical_act_name = $2, amount = $3, patient_code = $4, patient_first_name = $5, patient_last_name = $6, payment_time = $7, updated_at = NOW() WHERE id = $8 AND deleted_at IS NULL`,
+		p.MedicalActID, p.MedicalActName, p.Amount, p.PatientCode, p.PatientFirstName, p.PatientLastName, p.PaymentTime, p.ID))
+}
+
+// Delete soft-deletes a payment to preserve accounting integrity. It
+// returns ErrNotFound if there is no active payment with this id or its
+// patient is deleted.
+func (r *PaymentRepository) Delete(id int64) error {
+	return updatedOne(r.db.Exec(`UPDATE payments SET is_active = FALSE, updated_at = NOW() WHERE id = $1 AND is_active = TRUE AND deleted_at IS NULL`, id))
+}
+
+// IDsByPatientAndDate returns the ids of the active payments of a patient
+// on a day (YYYY-MM-DD)
+func (r *PaymentRepository) IDsByPatientAndDate(patientCode int, date string) ([]int64, error) {
+	rows, err := r.db.Query(`SELECT id FROM payments WHERE patient_code = $1 AND is_active = TRUE AND deleted_at IS NULL AND payment_time::date = $2::date`, patientCode, date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// DeleteByPatientAndDate soft-deletes the payments of a patient on a day
+// and returns how many were deleted
+func (r *PaymentRepository) DeleteByPatientAndDate(patientCode int, date string) (int64, error) {
+	result, err := r.db.Exec(`UPDATE payments SET is_active = FALSE, updated_at = NOW() WHERE patient_code = $1 AND is_active = TRUE AND deleted_at IS NULL AND payment_time::date = $2::date`, patientCode, date)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CountByPatientAndDate counts the active payments of a patient on a day
+func (r *PaymentRepository) CountByPatientAndDate(patientCode int, date string) (int, error) {
+	var count int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM payments WHERE patient_code = $1 AND is_active = TRUE AND deleted_at IS NULL AND payment_time::date = $2::date`, patientCode, date).Scan(&count)
+	return count, err
+}
+
+// MaxID returns the highest payment id, or 0 when there are no payments
+func (r *PaymentRepository) MaxID() (int64, error) {
+	var maxID int64
+	err := r.db.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM payments`).Scan(&maxID)
+	return maxID, err
+}
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"medicore/internal/models"
+)
+
+const surgeryPlanColumns = `id, surgery_date, surgery_hour, patient_code, patient_first_name, patient_last_name,
+	       patient_age, patient_phone, surgery_type, eye_to_operate, implant_power, tarif,
+	       payment_status, amount_remaining, surgery_status, patient_came, notes,
+	       created_at, created_by, updated_at, needs_sync`
+
+// SurgeryRepository reads and writes the surgery_plans table
+type SurgeryRepository struct {
+	db DBTX
+}
+
+// NewSurgeryRepository creates a surgery plan repository
+func NewSurgeryRepository(db DBTX) *SurgeryRepository {
+	return &SurgeryRepository{db: db}
+}
+
+func (r *SurgeryRepository) list(query string, args ...interface{}) ([]models.SurgeryPlan, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	plans := []models.SurgeryPlan{}
+	for rows.Next() {
+		var p models.SurgeryPlan
+		if err := rows.Scan(&p.ID, &p.SurgeryDate, &p.SurgeryHour, &p.PatientCode, &p.PatientFirstName, &p.PatientLastName,
+			&p.PatientAge, &p.PatientPhone, &p.SurgeryType, &p.EyeToOperate, &p.ImplantPower, &p.Tarif,
+			&p.PaymentStatus, &p.AmountRemaining, &p.SurgeryStatus, &p.PatientCame, &p.Notes,
+			&p.CreatedAt, &p.CreatedBy, &p.UpdatedAt, &p.NeedsSync); err != nil {
+			return nil, err
+		}
+		plans = append(plans, p)
+	}
+	return plans, rows.Err()
+}
+
+// GetForDate returns the surgeries of a day, by hour
+func (r *SurgeryRepository) GetForDate(date time.Time) ([]models.SurgeryPlan, error) {
+	startOfDay := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.Local)
+	endOfDay := time.Date(date.Year(), date.Month(), date.Day(), 23, 59, 59, 0, time.Local)
+
+	return r.list(`
+		SELECT `+surgeryPlanColumns+`
+		FROM surgery_plans 
+		WHERE surgery_date BETWEEN $1 AND $2 AND deleted_at IS NULL
+		ORDER BY surgery_hour
+	`, startOfDay, endOfDay)
+}
+
+// GetByID returns a surgery plan that is not deleted
+func (r *SurgeryRepository) GetByID(id int64) (*models.SurgeryPlan, error) {
+	plans, err := r.list(`
+		SELECT `+surgeryPlanColumns+`
+		FROM surgery_plans WHERE id = $1 AND deleted_at IS NULL
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(plans) == 0 {
+		return nil, ErrNotFound
+	}
+	return &plans[0], nil
+}
+
+// GetAll returns every surgery plan by date and hour
+func (r *SurgeryRepository) GetAll() ([]models.SurgeryPlan, error) {
+	return r.list(`
+		SELECT ` + surgeryPlanColumns + `
+		FROM surgery_plans 
+		WHERE deleted_at IS NULL
+		ORDER BY surgery_date, surgery_hour
+	`)
+}
+
+// ChangedSince returns the surgery plans written by the transactions from
+// fromTxid up to toTxid (excluded) that are not deleted
+func (r *SurgeryRepository) ChangedSince(fromTxid, toTxid int64) ([]models.SurgeryPlan, error) {
+	return r.list(`
+		SELECT `+surgeryPlanColumns+`
+		FROM surgery_plans WHERE sync_txid >= $1 AND sync_txid < $2 AND deleted_at IS NULL ORDER BY id
+	`, fromTxid, toTxid)
+}
+
+// Create inserts a surgery plan, pending payment and scheduled, and
+// returns its id
+func (r *SurgeryRepository) Create(p *models.SurgeryPlan) (int64, error) {
+	now := time.Now()
+	var id int64
+	err := r.db.QueryRow(`
+		INSERT INTO surgery_plans (surgery_date, surgery_hour, patient_code, patient_first_name, patient_last_name,
+		                          patient_age, patient_phone, surgery_type, eye_to_operate, implant_power, tarif,
+		                          payment_status, surgery_status, notes, created_by, created_at, updated_at, needs_sync)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, 'pending', 'scheduled', $12, $13, $14, $15, TRUE)
+		RETURNING id
+	`, p.SurgeryDate, p.SurgeryHour, p.PatientCode, p.PatientFirstName, p.PatientLastName,
+		p.PatientAge, p.PatientPhone, p.SurgeryType, p.EyeToOperate, p.ImplantPower, p.Tarif,
+		p.Notes, p.CreatedBy, now, now).Scan(&id)
+	return id, err
+}
+
+// Update applies the non-nil fields of changes to a surgery plan. It
+// reports false when there was nothing to change.
+func (r *SurgeryRepository) Update(id int64, changes *models.SurgeryPlanChanges) (bool, error) {
+	// Build dynamic update query, numbering the placeholders as they are added
+	updates := []string{}
+	args := []interface{}{}
+	set := func(column string, value interface{}) {
+		args = append(args, value)
+		updates = append(updates, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if changes.SurgeryDate != nil {
+		set("surgery_date", *changes.SurgeryDate)
+	}
+	if changes.SurgeryHour != nil {
+		set("surgery_hour", *changes.SurgeryHour)
+	}
+	if changes.SurgeryType != nil {
+		set("surgery_type", *changes.SurgeryType)
+	}
+	if changes.EyeToOperate != nil {
+		set("eye_to_operate", *changes.EyeToOperate)
+	}
+	if changes.ImplantPower != nil {
+		set("implant_power", *changes.ImplantPower)
+	}
+	if changes.Tarif != nil {
+		set("tarif", *changes.Tarif)
+	}
+	if changes.PaymentStatus != nil {
+		set("payment_status", *changes.PaymentStatus)
+	}
+	if changes.AmountRemaining != nil {
+		set("amount_remaining", *changes.AmountRemaining)
+	}
+	if changes.SurgeryStatus != nil {
+		set("surgery_status", *changes.SurgeryStatus)
+	}
+	if changes.PatientCame != nil {
+		set("patient_came", *changes.PatientCame)
+	}
+	if changes.Notes != nil {
+		set("notes", *changes.Notes)
+	}
+
+	if len(updates) == 0 {
+		return false, nil
+	}
+
+	set("updated_at", time.Now())
+	updates = append(updates, "needs_sync = TRUE")
+	args = append(args, id)
+
+	query := fmt.Sprintf("UPDATE surgery_plans SET %s WHERE id = $%d", strings.Join(updates, ", "), len(args))
+	_, err := r.db.Exec(query, args...)
+	return err == nil, err
+}
+
+// Delete removes a surgery plan
+func (r *SurgeryRepository) Delete(id int64) error {
+	_, err := r.db.Exec(`DELETE FROM surgery_plans WHERE id = $1`, id)
+	return err
+}
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"time"
+
+	"medicore/internal/models"
+)
+
+// SyncTable is a table whose changes are tracked for delta sync
+type SyncTable struct {
+	Name string
+	Key  string // Primary key column
+	Live string // Condition matching the rows that are not deleted
+}
+
+// SyncTables are the tracked tables. Every insert and update stamps the
+// row's sync_txid with the writing transaction, and hard deletions are
+// recorded in sync_deletions.
+var SyncTables = []SyncTable{
+	{Name: "patients", Key: "code", Live: "deleted_at IS NULL"},
+	{Name: "visits", Key: "id", Live: "(is_active = TRUE OR is_active IS NULL) AND deleted_at IS NULL"},
+	{Name: "payments", Key: "id", Live: "(is_active = TRUE OR is_active IS NULL) AND deleted_at IS NULL"},
+	{Name: "ordonnances", Key: "id", Live: "deleted_at IS NULL"},
+	{Name: "appointments", Key: "id", Live: "deleted_at IS NULL"},
+	{Name: "surgery_plans", Key: "id", Live: "deleted_at IS NULL"},
+}
+
+// SyncDeletionRetention is how long hard deletions are kept for delta sync
+const SyncDeletionRetention = 90 * 24 * time.Hour
+
+// syncPrunedKey is the app_metadata key holding the oldest cursor whose
+// deletions are all still in sync_deletions
+const syncPrunedKey = "sync_pruned_txid"
+
+// Changes holds the rows written between two sync cursors
+type Changes struct {
+	Cursor       int64                `json:"cursor"` // Cursor to send for the next changes
+	Full         bool                 `json:"full"`   // Every row was sent: drop the local copy first
+	Patients     []models.Patient     `json:"patients"`
+	Visits       []models.Visit       `json:"visits"`
+	Payments     []models.Payment     `json:"payments"`
+	Ordonnances  []models.Ordonnance  `json:"ordonnances"`
+	Appointments []models.Appointment `json:"appointments"`
+	SurgeryPlans []models.SurgeryPlan `json:"surgery_plans"`
+	Deleted      map[string][]int64   `json:"deleted"` // Keys of the deleted rows, by table
+}
+
+// SyncRepository reads the changes of the tracked tables
+type SyncRepository struct {
+	db DBTX
+}
+
+// NewSyncRepository creates a sync repository
+func NewSyncRepository(db DBTX) *SyncRepository {
+	return &SyncRepository{db: db}
+}
+
+// Changes returns the rows written since cursor, 0 for every row.
+//
+// Cursors are transaction IDs: the returned cursor is the oldest transaction
+// still running, and only rows written by older, finished transactions are
+// returned. A transaction committing late is therefore never skipped. When
+// the deletions after cursor were pruned, every row is returned instead.
+func (r *SyncRepository) Changes(cursor int64) (*Changes, error) {
+	var horizon, pruned int64
+	err := r.db.QueryRow(`
+		SELECT txid_snapshot_xmin(txid_current_snapshot()),
+		       COALESCE((SELECT value_int FROM app_metadata WHERE key = $1), 0)
+	`, syncPrunedKey).Scan(&horizon, &pruned)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := &Changes{Cursor: horizon, Deleted: map[string][]int64{}}
+	if cursor <= 0 || cursor < pruned {
+		changes.Full = true
+		cursor = 0
+	}
+
+	if changes.Patients, err = NewPatientRepository(r.db).ChangedSince(cursor, horizon); err != nil {
+		return nil, err
+	}
+	if changes.Visits, err = NewVisitRepository(r.db).ChangedSince(cursor, horizon); err != nil {
+		return nil, err
+	}
+	if changes.Payments, err = NewPaymentRepository(r.db).ChangedSince(cursor, horizon); err != nil {
+		return nil, err
+	}
+	if changes.Ordonnances, err = NewOrdonnanceRepository(r.db).ChangedSince(cursor, horizon); err != nil {
+		return nil, err
+	}
+	if changes.Appointments, err = NewAppointmentRepository(r.db).ChangedSince(cursor, horizon); err != nil {
+		return nil, err
+	}
+	if changes.SurgeryPlans, err = NewSurgeryRepository(r.db).ChangedSince(cursor, horizon); err != nil {
+		return nil, err
+	}
+
+	// A full sync has no local copy to delete from
+	if changes.Full {
+		return changes, nil
+	}
+	for _, table := range SyncTables {
+		keys, err := r.deletedSince(table, cursor, horizon)
+		if err != nil {
+			return nil, err
+		}
+		changes.Deleted[table.Name] = keys
+	}
+	return changes, nil
+}
+
+// deletedSince returns the keys of the rows of a table soft or hard deleted
+// by the transactions from fromTxid up to toTxid (excluded)
+func (r *SyncRepository) deletedSince(table SyncTable, fromTxid, toTxid int64) ([]int64, error) {
+	rows, err := r.db.Query(`
+		SELECT `+table.Key+` FROM `+table.Name+`
+		WHERE sync_txid >= $1 AND sync_txid < $2 AND NOT (`+table.Live+`)
+		UNION
+		SELECT row_key FROM sync_deletions
+		WHERE table_name = $3 AND sync_txid >= $1 AND sync_txid < $2
+		ORDER BY 1
+	`, fromTxid, toTxid, table.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []int64{}
+	for rows.Next() {
+		var key int64
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// PruneDeletions forgets the hard deletions recorded before a time and
+// returns how many were removed. Clients whose cursor is older then get a
+// full sync. Run it in a transaction.
+func (r *SyncRepository) PruneDeletions(before time.Time) (int64, error) {
+	var count, lastTxid int64
+	err := r.db.QueryRow(`
+		WITH pruned AS (DELETE FROM sync_deletions WHERE deleted_at < $1 RETURNING sync_txid)
+		SELECT COUNT(*), COALESCE(MAX(sync_txid), 0) FROM pruned
+	`, before).Scan(&count, &lastTxid)
+	if err != nil || count == 0 {
+		return 0, err
+	}
+
+	_, err = r.db.Exec(`
+		INSERT INTO app_metadata (key, value_int, updated_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (key) DO UPDATE SET
+			value_int = GREATEST(COALESCE(app_metadata.value_int, 0), EXCLUDED.value_int),
+			updated_at = NOW()
+	`, syncPrunedKey, lastTxid+1)
+	return count, err
+}
+
+// ForceFullSync makes every client do a full sync on its next call, e.g.
+// after the database was restored from a backup and the cursors of the
+// clients no longer mean anything
+func (r *SyncRepository) ForceFullSync() error {
+	_, err := r.db.Exec(`
+		INSERT INTO app_metadata (key, value_int, updated_at)
+		VALUES ($1, txid_current(), NOW())
+		ON CONFLICT (key) DO UPDATE SET value_int = EXCLUDED.value_int, updated_at = NOW()
+	`, syncPrunedKey)
+	return err
+}
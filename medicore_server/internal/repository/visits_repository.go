@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"medicore/internal/models"
+)
+
+const visitColumns = `id, patient_code, visit_sequence, visit_date, doctor_name, motif, diagnosis, conduct,
+	od_sv, od_av, od_sphere, od_cylinder, od_axis, od_vl, od_k1, od_k2, od_r1, od_r2, od_r0, od_pachy, od_toc, od_notes, od_gonio, od_to, od_laf, od_fo,
+	og_sv, og_av, og_sphere, og_cylinder, og_axis, og_vl, og_k1, og_k2, og_r1, og_r2, og_r0, og_pachy, og_toc, og_notes, og_gonio, og_to, og_laf, og_fo,
+	addition, dip, created_at`
+
+// VisitRepository reads and writes the visits table
+type VisitRepository struct {
+	db DBTX
+}
+
+// NewVisitRepository creates a visit repository
+func NewVisitRepository(db DBTX) *VisitRepository {
+	return &VisitRepository{db: db}
+}
+
+// examFields returns pointers to the exam columns shared by every query,
+// from doctor_name to dip, in column order
+func examFields(v *models.Visit) []interface{} {
+	return []interface{}{
+		&v.DoctorName, &v.Motif, &v.Diagnosis, &v.Conduct,
+		&v.OdSv, &v.OdAv, &v.OdSphere, &v.OdCylinder, &v.OdAxis, &v.OdVl, &v.OdK1, &v.OdK2, &v.OdR1, &v.OdR2, &v.OdR0, &v.OdPachy, &v.OdToc, &v.OdNotes, &v.OdGonio, &v.OdTo, &v.OdLaf, &v.OdFo,
+		&v.OgSv, &v.OgAv, &v.OgSphere, &v.OgCylinder, &v.OgAxis, &v.OgVl, &v.OgK1, &v.OgK2, &v.OgR1, &v.OgR2, &v.OgR0, &v.OgPachy, &v.OgToc, &v.OgNotes, &v.OgGonio, &v.OgTo, &v.OgLaf, &v.OgFo,
+		&v.Addition, &v.Dip,
+	}
+}
+
+// examValues returns the exam column values of a visit, in column order
+func examValues(v *models.Visit) []interface{} {
+	return []interface{}{
+		v.DoctorName, v.Motif, v.Diagnosis, v.Conduct,
+		v.OdSv, v.OdAv, v.OdSphere, v.OdCylinder, v.OdAxis, v.OdVl, v.OdK1, v.OdK2, v.OdR1, v.OdR2, v.OdR0, v.OdPachy, v.OdToc, v.OdNotes, v.OdGonio, v.OdTo, v.OdLaf, v.OdFo,
+		v.OgSv, v.OgAv, v.OgSphere, v.OgCylinder, v.OgAxis, v.OgVl, v.OgK1, v.OgK2, v.OgR1, v.OgR2, v.OgR0, v.OgPachy, v.OgToc, v.OgNotes, v.OgGonio, v.OgTo, v.OgLaf, v.OgFo,
+		v.Addition, v.Dip,
+	}
+}
+
+func scanVisit(row scanner) (*models.Visit, error) {
+	var v models.Visit
+	dest := []interface{}{&v.ID, &v.PatientCode, &v.VisitSequence, &v.VisitDate}
+	dest = append(dest, examFields(&v)...)
+	dest = append(dest, &v.CreatedAt)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (r *VisitRepository) list(query string, args ...interface{}) ([]models.Visit, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	visits := []models.Visit{}
+	for rows.Next() {
+		v, err := scanVisit(rows)
+		if err != nil {
+			return nil, err
+		}
+		visits = append(visits, *v)
+	}
+	return visits, rows.Err()
+}
+
+// GetForPatient returns the visits of a patient, most recent first
+func (r *VisitRepository) GetForPatient(patientCode int) ([]models.Visit, error) {
+	// Include old visits that might have NULL is_active (not explicitly deleted)
+	return r.list(`
+		SELECT `+visitColumns+`
+		FROM visits WHERE patient_code = $1 AND (is_active = TRUE OR is_active IS NULL) AND deleted_at IS NULL ORDER BY visit_date DESC
+	`, patientCode)
+}
+
+// ChangedSince returns the visits written by the transactions from
+// fromTxid up to toTxid (excluded) that are not deleted
+func (r *VisitRepository) ChangedSince(fromTxid, toTxid int64) ([]models.Visit, error) {
+	return r.list(`
+		SELECT `+visitColumns+`
+		FROM visits
+		WHERE sync_txid >= $1 AND sync_txid < $2 AND (is_active = TRUE OR is_active IS NULL) AND deleted_at IS NULL
+		ORDER BY id
+	`, fromTxid, toTxid)
+}
+
+// GetByID returns a visit by id
+func (r *VisitRepository) GetByID(id int64) (*models.Visit, error) {
+	v, err := scanVisit(r.db.QueryRow(`SELECT `+visitColumns+` FROM visits WHERE id = $1 AND deleted_at IS NULL`, id))
+	return v, notFound(err)
+}
+
+// Create inserts a visit and returns its id
+func (r *VisitRepository) Create(v *models.Visit) (int64, error) {
+	args := append([]interface{}{v.PatientCode, v.VisitSequence, v.VisitDate}, examValues(v)...)
+
+	var id int64
+	err := r.db.QueryRow(`
+		INSERT INTO visits (
+			patient_code, visit_sequence, visit_date, doctor_name, motif, diagnosis, conduct,
+			od_sv, od_av, od_sphere, od_cylinder, od_axis, od_vl, od_k1, od_k2, od_r1, od_r2, od_r0, od_pachy, od_toc, od_notes, od_gonio, od_to, od_laf, od_fo,
+			og_sv, og_av, og_sphere, og_cylinder, og_axis, og_vl, og_k1, og_k2, og_r1, og_r2, og_r0, og_pachy, og_toc, og_notes, og_gonio, og_to, og_laf, og_fo,
+			addition, dip, created_at, updated_at, is_active
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32, $33, $34, $35, $36, $37, $38, $39, $40, $41, $42, $43, $44, $45, NOW(), NOW(), TRUE)
+		RETURNING id
+	`, args...).Scan(&id)
+	return id, err
+}
+
+// InsertAll bulk-inserts imported visits and returns how many were stored.
+// Rows that fail to insert are skipped.
+func (r *VisitRepository) InsertAll(visits []models.Visit) int {
+	inserted := 0
+	for i := range visits {
+		v := &visits[i]
+		var visitSequence interface{}
+		if v.VisitSequence != 0 {
+			visitSequence = v.VisitSequence
+		}
+		args := append([]interface{}{v.PatientCode, visitSequence, v.VisitDate}, examValues(v)...)
+
+		_, err := r.db.Exec(`
+			INSERT INTO visits (
+				patient_code, visit_sequence, visit_date, doctor_name, motif, diagnosis, conduct,
+				od_sv, od_av, od_sphere, od_cylinder, od_axis, od_vl, od_k1, od_k2, od_r1, od_r2, od_r0, od_pachy, od_toc, od_notes, od_gonio, od_to, od_laf, od_fo,
+				og_sv, og_av, og_sphere, og_cylinder, og_axis, og_vl, og_k1, og_k2, og_r1, og_r2, og_r0, og_pachy, og_toc, og_notes, og_gonio, og_to, og_laf, og_fo,
+				addition, dip, is_active, created_at, updated_at, needs_sync
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32, $33, $34, $35, $36, $37, $38, $39, $40, $41, $42, $43, $44, $45, TRUE, NOW(), NOW(), TRUE)
+		`, args...)
+		if err == nil {
+			inserted++
+		}
+	}
+	return inserted
+}
+
+// Update changes the exam results of a visit. It returns ErrNotFound if
+// there is no visit with this id or its patient is deleted.
+func (r *VisitRepository) Update(v *models.Visit) error {
+	args := append(examValues(v), v.ID)
+	return updatedOne(r.db.Exec(`
+		UPDATE visits SET 
+			doctor_name = $1, motif = $2, diagnosis = $3, conduct = $4,
+			od_sv = $5, od_av = $6, od_sphere = $7, od_cylinder = $8, od_axis = $9, od_vl = $10, od_k1 = $11, od_k2 = $12, od_r1 = $13, od_r2 = $14, od_r0 = $15, od_pachy = $16, od_toc = $17, od_notes = $18, od_gonio = $19, od_to = $20, od_laf = $21, od_fo = $22,
+			og_sv = $23, og_av = $24, og_sphere = $25, og_cylinder = $26, og_axis = $27, og_vl = $28, og_k1 = $29, og_k2 = $30, og_r1 = $31, og_r2 = $32, og_r0 = $33, og_pachy = $34, og_toc = $35, og_notes = $36, og_gonio = $37, og_to = $38, og_laf = $39, og_fo = $40,
+			addition = $41, dip = $42, updated_at = NOW()
+		WHERE id = $43 AND deleted_at IS NULL`, args...))
+}
+
+// Delete soft-deletes a visit. It returns ErrNotFound if there is no active
+// visit with this id or its patient is deleted.
+func (r *VisitRepository) Delete(id int64) error {
+	return updatedOne(r.db.Exec(`UPDATE visits SET is_active = FALSE, updated_at = NOW() WHERE id = $1 AND is_active IS NOT FALSE AND deleted_at IS NULL`, id))
+}
+
+// DeleteAll removes every visit of live patients and returns how many were
+// deleted. Visits deleted along with a patient are kept so that
+// RestorePatient can bring them back.
+func (r *VisitRepository) DeleteAll() (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM visits WHERE deleted_at IS NULL`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Count returns the number of active visits
+func (r *VisitRepository) Count() (int, error) {
+	var count int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM visits WHERE is_active = TRUE AND deleted_at IS NULL`).Scan(&count)
+	return count, err
+}
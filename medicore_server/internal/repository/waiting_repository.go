@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"medicore/internal/models"
+)
+
+const waitingColumns = `id, patient_code, patient_first_name, patient_last_name, patient_age, is_urgent, is_dilatation, 
+		   dilatation_type, room_id, room_name, motif, sent_by_user_id, sent_by_user_name, sent_at, is_checked, is_active, is_notified`
+
+// WaitingRepository reads and writes the waiting queue (waiting_patients)
+type WaitingRepository struct {
+	db DBTX
+}
+
+// NewWaitingRepository creates a waiting queue repository
+func NewWaitingRepository(db DBTX) *WaitingRepository {
+	return &WaitingRepository{db: db}
+}
+
+func scanWaitingPatient(row scanner) (*models.WaitingPatient, error) {
+	var p models.WaitingPatient
+	err := row.Scan(&p.ID, &p.PatientCode, &p.PatientFirstName, &p.PatientLastName, &p.PatientAge, &p.IsUrgent, &p.IsDilatation,
+		&p.DilatationType, &p.RoomID, &p.RoomName, &p.Motif, &p.SentByUserID, &p.SentByUserName, &p.SentAt, &p.IsChecked, &p.IsActive, &p.IsNotified)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// GetByRoom returns the active queue of a room, oldest first
+func (r *WaitingRepository) GetByRoom(roomID string) ([]models.WaitingPatient, error) {
+	rows, err := r.db.Query(`
+		SELECT `+waitingColumns+`
+		FROM waiting_patients WHERE room_id = $1 AND is_active = TRUE AND deleted_at IS NULL ORDER BY sent_at ASC
+	`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	patients := []models.WaitingPatient{}
+	for rows.Next() {
+		p, err := scanWaitingPatient(rows)
+		if err != nil {
+			return nil, err
+		}
+		patients = append(patients, *p)
+	}
+	return patients, rows.Err()
+}
+
+// GetByID returns a queue entry by id
+func (r *WaitingRepository) GetByID(id int64) (*models.WaitingPatient, error) {
+	p, err := scanWaitingPatient(r.db.QueryRow(`SELECT `+waitingColumns+` FROM waiting_patients WHERE id = $1 AND deleted_at IS NULL`, id))
+	return p, notFound(err)
+}
+
+// RoomOf returns the room of a queue entry, or "" if it does not exist
+func (r *WaitingRepository) RoomOf(id int64) string {
+	var roomID string
+	r.db.QueryRow(`SELECT room_id FROM waiting_patients WHERE id = $1`, id).Scan(&roomID)
+	return roomID
+}
+
+// ActiveRoomOfPatient returns the room a patient is waiting in, or ""
+func (r *WaitingRepository) ActiveRoomOfPatient(patientCode int) string {
+	var roomID string
+	r.db.QueryRow(`SELECT room_id FROM waiting_patients WHERE patient_code = $1 AND is_active = TRUE AND deleted_at IS NULL`, patientCode).Scan(&roomID)
+	return roomID
+}
+
+// Add puts a patient in a room's queue and returns the entry id
+func (r *WaitingRepository) Add(p *models.WaitingPatient) (int64, error) {
+	var id int64
+	err := r.db.QueryRow(`
+		INSERT INTO waiting_patients (patient_code, patient_first_name, patient_last_name, patient_age, is_urgent, is_dilatation,
+			dilatation_type, room_id, room_name, motif, sent_by_user_id, sent_by_user_name, sent_at, is_checked, is_active, is_notified)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, NOW(), FALSE, TRUE, FALSE)
+		RETURNING id
+	`, p.PatientCode, p.PatientFirstName, p.PatientLastName, p.PatientAge, p.IsUrgent, p.IsDilatation,
+		p.DilatationType, p.RoomID, p.RoomName, p.Motif, p.SentByUserID, p.SentByUserName).Scan(&id)
+	return id, err
+}
+
+// ToggleChecked flips the checked flag of a queue entry
+func (r *WaitingRepository) ToggleChecked(id int64) error {
+	_, err := r.db.Exec(`UPDATE waiting_patients SET is_checked = NOT is_checked WHERE id = $1`, id)
+	return err
+}
+
+// SetFlags sets the checked and active flags of a queue entry. Nil flags
+// are left unchanged.
+func (r *WaitingRepository) SetFlags(id int64, isChecked, isActive *bool) error {
+	_, err := r.db.Exec(`
+		UPDATE waiting_patients SET is_checked = COALESCE($1, is_checked), is_active = COALESCE($2, is_active) WHERE id = $3
+	`, isChecked, isActive, id)
+	return err
+}
+
+// Remove takes an entry out of the queue
+func (r *WaitingRepository) Remove(id int64) error {
+	_, err := r.db.Exec(`UPDATE waiting_patients SET is_active = FALSE WHERE id = $1`, id)
+	return err
+}
+
+// RemoveByPatient takes a patient out of every queue
+func (r *WaitingRepository) RemoveByPatient(patientCode int) error {
+	_, err := r.db.Exec(`UPDATE waiting_patients SET is_active = FALSE WHERE patient_code = $1 AND is_active = TRUE`, patientCode)
+	return err
+}
+
+// MarkDilatationsNotified marks the active dilatations of a room as
+// notified
+func (r *WaitingRepository) MarkDilatationsNotified(roomID string) error {
+	_, err := r.db.Exec(`UPDATE waiting_patients SET is_notified = TRUE WHERE room_id = $1 AND is_dilatation = TRUE AND is_active = TRUE`, roomID)
+	return err
+}
@@ -0,0 +1,218 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Audit actions written to audit_log.action
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	AuditPurge   = "purge"
+)
+
+// auditedKeys is the primary key column of every audited table. It also
+// acts as a whitelist, since table names cannot be bound as parameters.
+var auditedKeys = map[string]string{
+	"patients":      "code",
+	"visits":        "id",
+	"ordonnances":   "id",
+	"payments":      "id",
+	"surgery_plans": "id",
+	"users":         "id",
+}
+
+// redactedColumns are never copied into audit snapshots
+var redactedColumns = []string{"password_hash"}
+
+// AuditEntry is one row of audit_log
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	UserID    string          `json:"user_id"`
+	Action    string          `json:"action"`
+	TableName string          `json:"table_name"`
+	RecordID  string          `json:"record_id"`
+	OldValues json.RawMessage `json:"old_values,omitempty"`
+	NewValues json.RawMessage `json:"new_values,omitempty"`
+	IPAddress string          `json:"ip_address"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// AuditFilter narrows an audit log query. Zero values are ignored.
+type AuditFilter struct {
+	TableName string
+	RecordID  string
+	UserID    string
+	From      time.Time
+	To        time.Time
+	Limit     int
+}
+
+// AuditService records who changed which row, and how
+type AuditService struct {
+	db *sql.DB
+}
+
+// NewAuditService creates a new audit service
+func NewAuditService(db *sql.DB) *AuditService {
+	return &AuditService{db: db}
+}
+
+// Snapshot returns the current state of a row as JSON, or nil if the row
+// does not exist
+func (s *AuditService) Snapshot(table string, recordID interface{}) (json.RawMessage, error) {
+	key, ok := auditedKeys[table]
+	if !ok {
+		return nil, fmt.Errorf("table %s is not audited", table)
+	}
+
+	var raw []byte
+	query := fmt.Sprintf(`SELECT row_to_json(t) FROM %s t WHERE t.%s = $1`, table, key)
+	err := s.db.QueryRow(query, recordID).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot %s %v: %w", table, recordID, err)
+	}
+	return redact(raw), nil
+}
+
+// SnapshotWhere returns the rows of a table matching a condition, as a
+// JSON array. Used before bulk deletes.
+func (s *AuditService) SnapshotWhere(table, condition string, args ...interface{}) (json.RawMessage, error) {
+	if _, ok := auditedKeys[table]; !ok {
+		return nil, fmt.Errorf("table %s is not audited", table)
+	}
+
+	var raw []byte
+	query := fmt.Sprintf(`SELECT COALESCE(json_agg(t), '[]'::json) FROM %s t WHERE %s`, table, condition)
+	if err := s.db.QueryRow(query, args...).Scan(&raw); err != nil {
+		return nil, fmt.Errorf("failed to snapshot %s: %w", table, err)
+	}
+	return redact(raw), nil
+}
+
+// Record writes an audit entry
+func (s *AuditService) Record(entry AuditEntry) error {
+	_, err := s.db.Exec(`
+		INSERT INTO audit_log (user_id, action, table_name, record_id, old_values, new_values, ip_address, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+	`, nullString(entry.UserID), entry.Action, entry.TableName, entry.RecordID,
+		nullJSON(entry.OldValues), nullJSON(entry.NewValues), nullString(entry.IPAddress))
+	if err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+	return nil
+}
+
+// Query returns audit entries matching a filter, newest first
+func (s *AuditService) Query(filter AuditFilter) ([]AuditEntry, error) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.TableName != "" {
+		add("table_name = $%d", filter.TableName)
+	}
+	if filter.RecordID != "" {
+		add("record_id = $%d", filter.RecordID)
+	}
+	if filter.UserID != "" {
+		add("user_id = $%d", filter.UserID)
+	}
+	if !filter.From.IsZero() {
+		add("created_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		add("created_at < $%d", filter.To)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 || limit > 1000 {
+		limit = 200
+	}
+
+	query := `
+		SELECT id, COALESCE(user_id, ''), action, COALESCE(table_name, ''), COALESCE(record_id, ''),
+		       old_values, new_values, COALESCE(ip_address, ''), created_at
+		FROM audit_log`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT %d", limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var oldValues, newValues []byte
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Action, &e.TableName, &e.RecordID,
+			&oldValues, &newValues, &e.IPAddress, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to read audit entry: %w", err)
+		}
+		if len(oldValues) > 0 {
+			e.OldValues = oldValues
+		}
+		if len(newValues) > 0 {
+			e.NewValues = newValues
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// redact removes sensitive columns from a row snapshot (an object or an
+// array of objects)
+func redact(raw []byte) json.RawMessage {
+	var snapshot interface{}
+	if err := json.Unmarshal(raw, &snapshot); err != nil {
+		return raw
+	}
+
+	rows, isArray := snapshot.([]interface{})
+	if !isArray {
+		rows = []interface{}{snapshot}
+	}
+	for _, row := range rows {
+		if fields, ok := row.(map[string]interface{}); ok {
+			for _, column := range redactedColumns {
+				delete(fields, column)
+			}
+		}
+	}
+
+	cleaned, err := json.Marshal(snapshot)
+	if err != nil {
+		return raw
+	}
+	return cleaned
+}
+
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func nullJSON(raw json.RawMessage) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+	return string(raw)
+}
@@ -1,33 +1,110 @@
 package services
 
 import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
+// Backup defaults, used when the BACKUP_* environment variables are not set
+const (
+	DefaultBackupDir           = "backups"
+	DefaultBackupIntervalHours = 24
+	DefaultBackupRetentionDays = 30
+)
+
+// Backup file names are backupPrefix + timestamp + backupExt, followed by
+// encryptedExt for encrypted backups
+const (
+	backupPrefix = "medicore_backup_"
+	backupExt    = ".sql.gz"
+	encryptedExt = ".enc"
+	partialExt   = ".partial" // Backups being written
+
+	backupTimeLayout = "20060102_150405"
+)
+
+var (
+	// ErrBackupNotFound is returned for a backup name that is not a backup
+	// of the backup directory
+	ErrBackupNotFound = errors.New("backup not found")
+	// ErrBackupBusy is returned while another backup or restore is running
+	ErrBackupBusy = errors.New("a backup or restore is already running")
+)
+
+// BackupInfo describes a backup file
+type BackupInfo struct {
+	Name      string          `json:"name"`
+	Size      int64           `json:"size"`
+	CreatedAt time.Time       `json:"created_at"`
+	Encrypted bool            `json:"encrypted"`
+	Manifest  *BackupManifest `json:"manifest,omitempty"` // Missing for backups made before manifests
+
+	Verification *BackupVerification `json:"verification,omitempty"` // Last test-restore, if any
+}
+
+// BackupStatus describes the last backups made by the service
+type BackupStatus struct {
+	Running       bool       `json:"running"`
+	LastAttemptAt *time.Time `json:"last_attempt_at,omitempty"`
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+	LastBackup    string     `json:"last_backup,omitempty"` // Name of the last successful backup
+	LastError     string     `json:"last_error,omitempty"`  // Error of the last attempt, if it failed
+	Interval      string     `json:"interval,omitempty"`    // Schedule, empty when not scheduled
+
+	LastVerification *BackupVerification `json:"last_verification,omitempty"`
+	Destinations     []DestinationStatus `json:"destinations"` // Off-site copies
+}
+
 // BackupService handles automated PostgreSQL backups
 type BackupService struct {
+	db         *sql.DB
 	backupDir  string
 	dbHost     string
 	dbPort     int
 	dbUser     string
 	dbName     string
 	dbPassword string
-	retention  int // Number of days to keep backups
+	retention  int    // Number of days to keep backups
+	secret     []byte // Encryption key or passphrase, nil for plain backups
+
+	busy     sync.Mutex // Held while a backup or restore runs
+	mutex    sync.RWMutex
+	status   BackupStatus
+	interval time.Duration // Schedule, 0 when not scheduled
+
+	onCreated []func(backupFilename string)
+
+	destinations      []DestinationConfig
+	destinationStatus map[string]*DestinationStatus
+	pushMutex         sync.Mutex // Serializes pushes to the destinations
+
+	restore *RestoreConfig // Nil until EnableStagedRestore
 }
 
-// NewBackupService creates a new backup service
-func NewBackupService(backupDir, dbHost string, dbPort int, dbUser, dbPassword, dbName string, retention int) (*BackupService, error) {
-	// Create backup directory if it doesn't exist
-	if err := os.MkdirAll(backupDir, 0755); err != nil {
+// NewBackupService creates a new backup service. db is used to read the
+// content of the backups for their manifest.
+func NewBackupService(db *sql.DB, backupDir, dbHost string, dbPort int, dbUser, dbPassword, dbName string, retention int) (*BackupService, error) {
+	// Create backup directory if it doesn't exist, readable by the server only
+	if err := os.MkdirAll(backupDir, 0700); err != nil {
 		return nil, fmt.Errorf("failed to create backup directory: %w", err)
 	}
 
 	return &BackupService{
+		db:         db,
 		backupDir:  backupDir,
 		dbHost:     dbHost,
 		dbPort:     dbPort,
@@ -35,17 +112,106 @@ func NewBackupService(backupDir, dbHost string, dbPort int, dbUser, dbPassword,
 		dbName:     dbName,
 		dbPassword: dbPassword,
 		retention:  retention,
+
+		destinationStatus: make(map[string]*DestinationStatus),
 	}, nil
 }
 
-// CreateBackup creates a PostgreSQL backup
+// SetEncryptionSecret makes new backups encrypted with a key derived from
+// secret, a BACKUP_KEY or a passphrase. Encrypted backups need the same
+// secret to be restored.
+func (bs *BackupService) SetEncryptionSecret(secret []byte) {
+	bs.secret = secret
+}
+
+// Encrypted reports whether new backups are encrypted
+func (bs *BackupService) Encrypted() bool {
+	return len(bs.secret) > 0
+}
+
+// OnCreated registers a function called after each successful backup
+func (bs *BackupService) OnCreated(fn func(backupFilename string)) {
+	bs.onCreated = append(bs.onCreated, fn)
+}
+
+// CreateBackup creates a PostgreSQL backup and returns its path. It fails
+// with ErrBackupBusy while another backup or restore is running.
 func (bs *BackupService) CreateBackup() (string, error) {
-	timestamp := time.Now().Format("20060102_150405")
-	filename := fmt.Sprintf("medicore_backup_%s.sql.gz", timestamp)
+	if !bs.busy.TryLock() {
+		return "", ErrBackupBusy
+	}
+	defer bs.busy.Unlock()
+	return bs.runBackup()
+}
+
+// runBackup creates a backup, records it in the status and runs the hooks.
+// busy must be held.
+func (bs *BackupService) runBackup() (string, error) {
+	started := time.Now()
+	bs.mutex.Lock()
+	bs.status.Running = true
+	bs.status.LastAttemptAt = &started
+	bs.mutex.Unlock()
+
+	backupPath, err := bs.createBackup()
+
+	bs.mutex.Lock()
+	bs.status.Running = false
+	if err != nil {
+		bs.status.LastError = err.Error()
+	} else {
+		finished := time.Now()
+		bs.status.LastSuccessAt = &finished
+		bs.status.LastBackup = filepath.Base(backupPath)
+		bs.status.LastError = ""
+	}
+	bs.mutex.Unlock()
+
+	if err == nil {
+		for _, fn := range bs.onCreated {
+			fn(filepath.Base(backupPath))
+		}
+		bs.mutex.RLock()
+		offsite := len(bs.destinations) > 0
+		bs.mutex.RUnlock()
+		if offsite {
+			go bs.PushBackups()
+		}
+	}
+	return backupPath, err
+}
+
+// createBackup dumps the database to a new backup file, compressed then
+// encrypted if a secret is set, and writes its manifest. The dump and the
+// manifest row counts come from the same snapshot. Nothing is left behind
+// if the dump fails.
+func (bs *BackupService) createBackup() (string, error) {
+	timestamp := time.Now().Format(backupTimeLayout)
+	filename := backupPrefix + timestamp + backupExt
+	if bs.Encrypted() {
+		filename += encryptedExt
+	}
 	backupPath := filepath.Join(bs.backupDir, filename)
+	partialPath := backupPath + partialExt
 
 	log.Printf("📦 Creating backup: %s", filename)
 
+	manifest := &BackupManifest{Name: filename, CreatedAt: time.Now(), Encrypted: bs.Encrypted()}
+
+	// Export a snapshot for pg_dump; it stays valid while tx is open
+	tx, err := bs.db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return "", fmt.Errorf("failed to start backup transaction: %w", err)
+	}
+	defer tx.Rollback()
+	var snapshot string
+	if err := tx.QueryRow(`SELECT pg_export_snapshot()`).Scan(&snapshot); err != nil {
+		return "", fmt.Errorf("failed to export snapshot: %w", err)
+	}
+	if err := snapshotContent(tx, manifest); err != nil {
+		return "", err
+	}
+
 	// Set PGPASSWORD environment variable
 	env := os.Environ()
 	env = append(env, fmt.Sprintf("PGPASSWORD=%s", bs.dbPassword))
@@ -60,60 +226,97 @@ func (bs *BackupService) CreateBackup() (string, error) {
 		"-F", "p", // Plain text format
 		"--no-owner",
 		"--no-acl",
+		"--snapshot", snapshot,
 	)
 
 	cmd.Env = env
 
-	// Create gzip command
-	gzipCmd := exec.Command("gzip")
-
 	// Create output file
-	outFile, err := os.Create(backupPath)
+	outFile, err := os.OpenFile(partialPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
 	if err != nil {
 		return "", fmt.Errorf("failed to create backup file: %w", err)
 	}
 	defer outFile.Close()
+	complete := false
+	defer func() {
+		if !complete {
+			os.Remove(partialPath)
+		}
+	}()
+
+	// pg_dump -> gzip -> encryption -> file, hashing what is stored
+	hash := sha256.New()
+	stored := io.MultiWriter(outFile, hash)
+	var encrypted *encryptWriter
+	compressed := stored
+	if bs.Encrypted() {
+		if encrypted, err = newEncryptWriter(stored, bs.secret); err != nil {
+			return "", fmt.Errorf("failed to start encryption: %w", err)
+		}
+		compressed = encrypted
+	}
+	gzipWriter := gzip.NewWriter(compressed)
 
-	// Pipe pg_dump output to gzip, then to file
 	pipe, err := cmd.StdoutPipe()
 	if err != nil {
 		return "", fmt.Errorf("failed to create pipe: %w", err)
 	}
 
-	gzipCmd.Stdin = pipe
-	gzipCmd.Stdout = outFile
-
-	// Start both commands
 	if err := cmd.Start(); err != nil {
 		return "", fmt.Errorf("failed to start pg_dump: %w", err)
 	}
 
-	if err := gzipCmd.Start(); err != nil {
-		return "", fmt.Errorf("failed to start gzip: %w", err)
+	if _, err := io.Copy(gzipWriter, pipe); err != nil {
+		cmd.Wait()
+		return "", fmt.Errorf("failed to write backup: %w", err)
 	}
 
-	// Wait for commands to finish
+	// Wait for pg_dump to finish
 	if err := cmd.Wait(); err != nil {
 		return "", fmt.Errorf("pg_dump failed: %w", err)
 	}
+	tx.Rollback()
 
-	if err := gzipCmd.Wait(); err != nil {
-		return "", fmt.Errorf("gzip failed: %w", err)
+	if err := gzipWriter.Close(); err != nil {
+		return "", fmt.Errorf("failed to compress backup: %w", err)
+	}
+	if encrypted != nil {
+		if err := encrypted.Close(); err != nil {
+			return "", fmt.Errorf("failed to encrypt backup: %w", err)
+		}
+	}
+	if err := outFile.Sync(); err != nil {
+		return "", fmt.Errorf("failed to write backup: %w", err)
 	}
 
 	// Get file size
-	info, err := os.Stat(backupPath)
+	info, err := outFile.Stat()
 	if err != nil {
 		return "", fmt.Errorf("failed to get backup file info: %w", err)
 	}
+	manifest.Size = info.Size()
+	manifest.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	if err := writeManifest(backupPath, manifest); err != nil {
+		return "", fmt.Errorf("failed to write backup manifest: %w", err)
+	}
+	if err := os.Rename(partialPath, backupPath); err != nil {
+		os.Remove(manifestPath(backupPath))
+		return "", fmt.Errorf("failed to save backup: %w", err)
+	}
 
 	log.Printf("✅ Backup created: %s (%.2f MB)", filename, float64(info.Size())/1024/1024)
 
+	complete = true
 	return backupPath, nil
 }
 
-// CleanupOldBackups removes backups older than retention period
+// CleanupOldBackups removes backups older than retention period. A
+// retention of 0 or less keeps backups forever.
 func (bs *BackupService) CleanupOldBackups() error {
+	if bs.retention <= 0 {
+		return nil
+	}
 	cutoff := time.Now().AddDate(0, 0, -bs.retention)
 
 	entries, err := os.ReadDir(bs.backupDir)
@@ -123,7 +326,7 @@ func (bs *BackupService) CleanupOldBackups() error {
 
 	deletedCount := 0
 	for _, entry := range entries {
-		if entry.IsDir() {
+		if entry.IsDir() || !isBackupName(entry.Name()) {
 			continue
 		}
 
@@ -137,6 +340,8 @@ func (bs *BackupService) CleanupOldBackups() error {
 			if err := os.Remove(path); err != nil {
 				log.Printf("⚠️ Failed to delete old backup %s: %v", entry.Name(), err)
 			} else {
+				os.Remove(manifestPath(path))
+				os.Remove(path + verificationExt)
 				deletedCount++
 			}
 		}
@@ -149,81 +354,190 @@ func (bs *BackupService) CleanupOldBackups() error {
 	return nil
 }
 
-// ListBackups returns a list of available backups
-func (bs *BackupService) ListBackups() ([]string, error) {
+// ListBackups returns the available backups, newest first
+func (bs *BackupService) ListBackups() ([]BackupInfo, error) {
 	entries, err := os.ReadDir(bs.backupDir)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read backup directory: %w", err)
 	}
 
-	var backups []string
+	backups := []BackupInfo{}
 	for _, entry := range entries {
-		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".gz" {
-			backups = append(backups, entry.Name())
+		if entry.IsDir() || !isBackupName(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
 		}
+		backup := BackupInfo{
+			Name:      entry.Name(),
+			Size:      info.Size(),
+			CreatedAt: info.ModTime(),
+			Encrypted: strings.HasSuffix(entry.Name(), encryptedExt),
+		}
+		if manifest, err := readManifest(filepath.Join(bs.backupDir, entry.Name())); err == nil {
+			backup.Manifest = manifest
+		}
+		if verification, err := readVerification(filepath.Join(bs.backupDir, entry.Name())); err == nil {
+			backup.Verification = verification
+		}
+		backups = append(backups, backup)
 	}
 
+	sort.Slice(backups, func(i, j int) bool { return backups[i].CreatedAt.After(backups[j].CreatedAt) })
 	return backups, nil
 }
 
-// RestoreBackup restores from a backup file
-func (bs *BackupService) RestoreBackup(backupFilename string) error {
-	backupPath := filepath.Join(bs.backupDir, backupFilename)
+// OpenBackup opens a backup file for reading
+func (bs *BackupService) OpenBackup(backupFilename string) (*os.File, error) {
+	backupPath, err := bs.backupPath(backupFilename)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(backupPath)
+}
 
-	// Check if backup exists
-	if _, err := os.Stat(backupPath); os.IsNotExist(err) {
-		return fmt.Errorf("backup file not found: %s", backupFilename)
+// Status returns the state of the last backups
+func (bs *BackupService) Status() BackupStatus {
+	bs.mutex.RLock()
+	defer bs.mutex.RUnlock()
+	status := bs.status
+	status.Destinations = make([]DestinationStatus, 0, len(bs.destinations))
+	for _, cfg := range bs.destinations {
+		status.Destinations = append(status.Destinations, *bs.destinationStatus[cfg.Name])
 	}
+	return status
+}
 
-	log.Printf("🔄 Restoring from backup: %s", backupFilename)
+// setVerification records the last verification result
+func (bs *BackupService) setVerification(verification *BackupVerification) {
+	bs.mutex.Lock()
+	bs.status.LastVerification = verification
+	bs.mutex.Unlock()
+}
 
-	// Set PGPASSWORD environment variable
-	env := os.Environ()
-	env = append(env, fmt.Sprintf("PGPASSWORD=%s", bs.dbPassword))
+// Health summarizes the backup status: "ok", "never" before the first
+// backup, "failed" when the last attempt failed, "unverified" when the last
+// backup failed its test-restore, "stale" when the last backup is older
+// than two scheduled intervals, or "offsite_failed" when the last upload to
+// a destination failed
+func (bs *BackupService) Health() string {
+	bs.mutex.RLock()
+	defer bs.mutex.RUnlock()
+	verification := bs.status.LastVerification
+	switch {
+	case bs.status.LastError != "":
+		return "failed"
+	case bs.status.LastSuccessAt == nil:
+		return "never"
+	case verification != nil && verification.Backup == bs.status.LastBackup && !verification.Passed:
+		return "unverified"
+	case bs.interval > 0 && time.Since(*bs.status.LastSuccessAt) > 2*bs.interval:
+		return "stale"
+	}
+	for _, status := range bs.destinationStatus {
+		if status.LastError != "" {
+			return "offsite_failed"
+		}
+	}
+	return "ok"
+}
 
-	// Create gunzip command
-	gunzipCmd := exec.Command("gunzip", "-c", backupPath)
+// isBackupName reports whether a file name is one of a backup
+func isBackupName(name string) bool {
+	return strings.HasPrefix(name, backupPrefix) &&
+		(strings.HasSuffix(name, backupExt) || strings.HasSuffix(name, backupExt+encryptedExt))
+}
 
-	// Create psql command
-	psqlCmd := exec.Command(
-		"psql",
-		"-h", bs.dbHost,
-		"-p", fmt.Sprintf("%d", bs.dbPort),
-		"-U", bs.dbUser,
-		"-d", bs.dbName,
-	)
+// backupPath returns the path of an existing backup. Names are never
+// allowed to point outside the backup directory.
+func (bs *BackupService) backupPath(backupFilename string) (string, error) {
+	if filepath.Base(backupFilename) != backupFilename || !isBackupName(backupFilename) {
+		return "", ErrBackupNotFound
+	}
+	backupPath := filepath.Join(bs.backupDir, backupFilename)
+	if info, err := os.Stat(backupPath); err != nil || info.IsDir() {
+		return "", ErrBackupNotFound
+	}
+	return backupPath, nil
+}
 
-	psqlCmd.Env = env
+// VerifyBackup checks a backup against its manifest: the checksum must
+// match and the whole file must decrypt and decompress. It fails with
+// ErrBackupCorrupt otherwise.
+func (bs *BackupService) VerifyBackup(backupFilename string) (*BackupManifest, error) {
+	backupPath, err := bs.backupPath(backupFilename)
+	if err != nil {
+		return nil, err
+	}
+	return bs.verify(backupPath)
+}
 
-	// Pipe gunzip output to psql
-	pipe, err := gunzipCmd.StdoutPipe()
+func (bs *BackupService) verify(backupPath string) (*BackupManifest, error) {
+	manifest, err := readManifest(backupPath)
 	if err != nil {
-		return fmt.Errorf("failed to create pipe: %w", err)
+		return nil, fmt.Errorf("%w: no readable manifest: %v", ErrBackupCorrupt, err)
 	}
 
-	psqlCmd.Stdin = pipe
+	checksum, err := fileChecksum(backupPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup: %w", err)
+	}
+	if checksum != manifest.SHA256 {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrBackupCorrupt)
+	}
 
-	// Start both commands
-	if err := gunzipCmd.Start(); err != nil {
-		return fmt.Errorf("failed to start gunzip: %w", err)
+	dump, err := bs.openDump(backupPath)
+	if err != nil {
+		return nil, err
+	}
+	defer dump.Close()
+	if _, err := io.Copy(io.Discard, dump); err != nil {
+		if errors.Is(err, ErrBackupCorrupt) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", ErrBackupCorrupt, err)
 	}
+	return manifest, nil
+}
 
-	if err := psqlCmd.Start(); err != nil {
-		return fmt.Errorf("failed to start psql: %w", err)
+// openDump returns the SQL dump of a backup, decrypted and decompressed
+func (bs *BackupService) openDump(backupPath string) (io.ReadCloser, error) {
+	file, err := os.Open(backupPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup: %w", err)
 	}
 
-	// Wait for commands to finish
-	if err := gunzipCmd.Wait(); err != nil {
-		return fmt.Errorf("gunzip failed: %w", err)
+	var compressed io.Reader = file
+	if strings.HasSuffix(backupPath, encryptedExt) {
+		if !bs.Encrypted() {
+			file.Close()
+			return nil, ErrBackupKeyMissing
+		}
+		if compressed, err = newDecryptReader(file, bs.secret); err != nil {
+			file.Close()
+			return nil, err
+		}
 	}
 
-	if err := psqlCmd.Wait(); err != nil {
-		return fmt.Errorf("psql failed: %w", err)
+	gzipReader, err := gzip.NewReader(compressed)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%w: %v", ErrBackupCorrupt, err)
 	}
+	return &dumpReader{Reader: gzipReader, file: file}, nil
+}
 
-	log.Printf("✅ Backup restored successfully")
+// dumpReader closes the backup file with the dump
+type dumpReader struct {
+	*gzip.Reader
+	file *os.File
+}
 
-	return nil
+func (d *dumpReader) Close() error {
+	d.Reader.Close()
+	return d.file.Close()
 }
 
 // ScheduleBackup creates a backup on a schedule
@@ -231,7 +545,12 @@ func (bs *BackupService) ScheduleBackup(interval time.Duration) {
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
-	log.Printf("⏰ Backup scheduler started (interval: %v)", interval)
+	bs.mutex.Lock()
+	bs.interval = interval
+	bs.status.Interval = interval.String()
+	bs.mutex.Unlock()
+
+	log.Printf("⏰ Backup scheduler started (interval: %v, retention: %d days)", interval, bs.retention)
 
 	for range ticker.C {
 		if _, err := bs.CreateBackup(); err != nil {
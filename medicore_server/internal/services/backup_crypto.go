@@ -0,0 +1,211 @@
+package services
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Encrypted backups are backupMagic, a random salt, then the compressed
+// dump in AES-256-GCM chunks, each prefixed with its length. The key is
+// derived from the configured secret and the salt, so every file has its
+// own key. The last chunk is sealed as such, so a truncated file is
+// detected like a tampered one.
+const (
+	backupMagic     = "MEDICORE-BACKUP1"
+	backupSaltSize  = 16
+	backupChunkSize = 64 * 1024
+)
+
+// backupKeySize is the size of a BACKUP_KEY and of derived keys (AES-256)
+const backupKeySize = 32
+
+var (
+	// ErrBackupCorrupt is returned for a backup whose checksum does not match
+	// its manifest, or that cannot be decrypted
+	ErrBackupCorrupt = errors.New("backup is corrupt or the encryption key is wrong")
+	// ErrBackupKeyMissing is returned for an encrypted backup when no
+	// encryption key is configured
+	ErrBackupKeyMissing = errors.New("backup is encrypted and no backup key is configured")
+)
+
+// ParseBackupKey decodes a hex encoded 256-bit backup key
+func ParseBackupKey(hexKey string) ([]byte, error) {
+	key, err := hex.DecodeString(hexKey)
+	if err != nil || len(key) != backupKeySize {
+		return nil, fmt.Errorf("backup key must be %d hex characters", 2*backupKeySize)
+	}
+	return key, nil
+}
+
+// backupCipher derives the cipher of a backup from the secret and the salt
+func backupCipher(secret, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(secret, salt, 1<<15, 8, 1, backupKeySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce returns the nonce of the nth chunk. Nonces never repeat for a
+// key since every file has its own key.
+func chunkNonce(aead cipher.AEAD, n uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], n)
+	return nonce
+}
+
+// chunkAAD marks the last chunk
+func chunkAAD(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// encryptWriter encrypts what is written to it. Close writes the last chunk
+// but does not close the underlying writer.
+type encryptWriter struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	buf   []byte
+	count uint64
+}
+
+// newEncryptWriter writes the header of an encrypted backup to w
+func newEncryptWriter(w io.Writer, secret []byte) (*encryptWriter, error) {
+	salt := make([]byte, backupSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := backupCipher(secret, salt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write([]byte(backupMagic)); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(salt); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, aead: aead, buf: make([]byte, 0, backupChunkSize)}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// A full chunk is only sealed once more data follows, so that the
+		// last chunk is always sealed by Close
+		if len(e.buf) == backupChunkSize {
+			if err := e.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(e.buf[len(e.buf):backupChunkSize], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Close seals the last chunk
+func (e *encryptWriter) Close() error {
+	return e.seal(true)
+}
+
+func (e *encryptWriter) seal(last bool) error {
+	sealed := e.aead.Seal(nil, chunkNonce(e.aead, e.count), e.buf, chunkAAD(last))
+	e.count++
+	e.buf = e.buf[:0]
+
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(sealed)))
+	if _, err := e.w.Write(length[:]); err != nil {
+		return err
+	}
+	_, err := e.w.Write(sealed)
+	return err
+}
+
+// decryptReader decrypts an encrypted backup. Reads fail with
+// ErrBackupCorrupt when a chunk was altered, or the file truncated.
+type decryptReader struct {
+	r     *bufio.Reader
+	aead  cipher.AEAD
+	buf   []byte
+	count uint64
+	last  bool
+}
+
+// newDecryptReader reads the header of an encrypted backup from r
+func newDecryptReader(r io.Reader, secret []byte) (*decryptReader, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(backupMagic)+backupSaltSize)
+	if _, err := io.ReadFull(br, header); err != nil || string(header[:len(backupMagic)]) != backupMagic {
+		return nil, fmt.Errorf("%w: not an encrypted backup", ErrBackupCorrupt)
+	}
+	aead, err := backupCipher(secret, header[len(backupMagic):])
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{r: br, aead: aead}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.last {
+			if _, err := d.r.ReadByte(); err != io.EOF {
+				return 0, fmt.Errorf("%w: data after the last chunk", ErrBackupCorrupt)
+			}
+			return 0, io.EOF
+		}
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+// open decrypts the next chunk
+func (d *decryptReader) open() error {
+	var length [4]byte
+	if _, err := io.ReadFull(d.r, length[:]); err != nil {
+		return fmt.Errorf("%w: truncated", ErrBackupCorrupt)
+	}
+	size := binary.BigEndian.Uint32(length[:])
+	if size > backupChunkSize+uint32(d.aead.Overhead()) {
+		return fmt.Errorf("%w: invalid chunk", ErrBackupCorrupt)
+	}
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(d.r, sealed); err != nil {
+		return fmt.Errorf("%w: truncated", ErrBackupCorrupt)
+	}
+
+	nonce := chunkNonce(d.aead, d.count)
+	plain, err := d.aead.Open(nil, nonce, sealed, chunkAAD(false))
+	if err != nil {
+		plain, err = d.aead.Open(nil, nonce, sealed, chunkAAD(true))
+		if err != nil {
+			return ErrBackupCorrupt
+		}
+		d.last = true
+	}
+	d.count++
+	d.buf = plain
+	return nil
+}
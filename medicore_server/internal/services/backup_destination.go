@@ -0,0 +1,380 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Off-site destination types
+const (
+	DestinationDirectory = "directory" // A second local path, e.g. a NAS mount
+	DestinationSFTP      = "sftp"
+	DestinationS3        = "s3" // Any S3-compatible object storage
+)
+
+const (
+	// destinationDialTimeout bounds connecting to a destination, handshake
+	// included
+	destinationDialTimeout = 30 * time.Second
+	// defaultPushTimeout bounds a push to one destination, uploads included,
+	// when its configuration sets no timeout_minutes
+	defaultPushTimeout = time.Hour
+)
+
+// DestinationConfig configures an off-site backup destination. Which fields
+// are used depends on the type.
+type DestinationConfig struct {
+	Name           string `json:"name"`
+	Type           string `json:"type"`
+	RetentionDays  int    `json:"retention_days"`  // 0 or less keeps backups forever
+	TimeoutMinutes int    `json:"timeout_minutes"` // Limit on a push, uploads included; 0 or less for an hour
+	Path           string `json:"path"`            // Directory, SFTP directory or S3 key prefix
+
+	// SFTP
+	Host                  string `json:"host"` // host:port
+	User                  string `json:"user"`
+	Password              string `json:"password"`
+	PrivateKeyFile        string `json:"private_key_file"`
+	KnownHostsFile        string `json:"known_hosts_file"`
+	InsecureIgnoreHostKey bool   `json:"insecure_ignore_host_key"`
+
+	// S3
+	Endpoint  string `json:"endpoint"` // host:port, e.g. s3.amazonaws.com or localhost:9000 for MinIO
+	Bucket    string `json:"bucket"`
+	Region    string `json:"region"`
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+	UseSSL    bool   `json:"use_ssl"`
+}
+
+// Validate checks that the fields needed by the destination type are set
+func (cfg DestinationConfig) Validate() error {
+	if cfg.Name == "" {
+		return fmt.Errorf("backup destination without a name")
+	}
+	missing := func(field string) error {
+		return fmt.Errorf("backup destination %s: %s is required", cfg.Name, field)
+	}
+	switch cfg.Type {
+	case DestinationDirectory:
+		if cfg.Path == "" {
+			return missing("path")
+		}
+	case DestinationSFTP:
+		switch {
+		case cfg.Host == "":
+			return missing("host")
+		case cfg.User == "":
+			return missing("user")
+		case cfg.Password == "" && cfg.PrivateKeyFile == "":
+			return missing("password or private_key_file")
+		case cfg.KnownHostsFile == "" && !cfg.InsecureIgnoreHostKey:
+			return missing("known_hosts_file")
+		}
+	case DestinationS3:
+		switch {
+		case cfg.Endpoint == "":
+			return missing("endpoint")
+		case cfg.Bucket == "":
+			return missing("bucket")
+		}
+	default:
+		return fmt.Errorf("backup destination %s: unknown type %q", cfg.Name, cfg.Type)
+	}
+	return nil
+}
+
+// LoadDestinationConfigs reads a JSON array of destination configurations
+func LoadDestinationConfigs(path string) ([]DestinationConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs []DestinationConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("invalid backup destinations file %s: %w", path, err)
+	}
+	return configs, nil
+}
+
+// BackupDestination stores copies of the backup files
+type BackupDestination interface {
+	// Put stores a file, replacing any file of the same name
+	Put(name string, r io.Reader, size int64) error
+	// List returns the names of the stored files
+	List() ([]string, error)
+	// Delete removes a file
+	Delete(name string) error
+	// Close ends the session with the destination
+	Close() error
+}
+
+// pushTimeout is how long a push to the destination may take
+func (cfg DestinationConfig) pushTimeout() time.Duration {
+	if cfg.TimeoutMinutes <= 0 {
+		return defaultPushTimeout
+	}
+	return time.Duration(cfg.TimeoutMinutes) * time.Minute
+}
+
+// open starts a session with the destination. Remote destinations abort
+// what they are doing once ctx is done.
+func (cfg DestinationConfig) open(ctx context.Context) (BackupDestination, error) {
+	switch cfg.Type {
+	case DestinationDirectory:
+		return openDirectoryDestination(cfg)
+	case DestinationSFTP:
+		return openSFTPDestination(ctx, cfg)
+	case DestinationS3:
+		return openS3Destination(ctx, cfg)
+	}
+	return nil, fmt.Errorf("unknown backup destination type %q", cfg.Type)
+}
+
+// DestinationStatus describes the last uploads to a destination
+type DestinationStatus struct {
+	Name          string     `json:"name"`
+	Type          string     `json:"type"`
+	RetentionDays int        `json:"retention_days"`
+	LastAttemptAt *time.Time `json:"last_attempt_at,omitempty"`
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"` // Every backup was up to date
+	LastUploaded  string     `json:"last_uploaded,omitempty"`   // Name of the last backup uploaded
+	LastError     string     `json:"last_error,omitempty"`
+	Stored        int        `json:"stored"` // Backups on the destination after the last success
+}
+
+// AddDestination makes the service copy every backup to a destination
+func (bs *BackupService) AddDestination(cfg DestinationConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	bs.mutex.Lock()
+	defer bs.mutex.Unlock()
+	for _, existing := range bs.destinations {
+		if existing.Name == cfg.Name {
+			return fmt.Errorf("backup destination %s is configured twice", cfg.Name)
+		}
+	}
+	bs.destinations = append(bs.destinations, cfg)
+	bs.destinationStatus[cfg.Name] = &DestinationStatus{Name: cfg.Name, Type: cfg.Type, RetentionDays: cfg.RetentionDays}
+	log.Printf("📤 Backup destination %s (%s) added", cfg.Name, cfg.Type)
+	return nil
+}
+
+// PushBackups brings every destination up to date: the local backups
+// missing there, within its retention, are uploaded and its expired ones
+// deleted. Failed uploads are thus retried on the next push.
+func (bs *BackupService) PushBackups() {
+	bs.pushMutex.Lock()
+	defer bs.pushMutex.Unlock()
+
+	bs.mutex.RLock()
+	destinations := append([]DestinationConfig(nil), bs.destinations...)
+	bs.mutex.RUnlock()
+
+	for _, cfg := range destinations {
+		started := time.Now()
+		uploaded, stored, err := bs.push(cfg)
+
+		bs.mutex.Lock()
+		status := bs.destinationStatus[cfg.Name]
+		status.LastAttemptAt = &started
+		if uploaded != "" {
+			status.LastUploaded = uploaded
+		}
+		if err != nil {
+			status.LastError = err.Error()
+		} else {
+			finished := time.Now()
+			status.LastSuccessAt = &finished
+			status.LastError = ""
+			status.Stored = stored
+		}
+		bs.mutex.Unlock()
+
+		if err != nil {
+			log.Printf("❌ Backup upload to %s failed: %v", cfg.Name, err)
+		}
+	}
+}
+
+// push brings one destination up to date. It returns the last backup
+// uploaded and how many backups the destination holds. A push taking longer
+// than the destination's timeout is aborted, so that a hung server does not
+// hold up the other destinations.
+func (bs *BackupService) push(cfg DestinationConfig) (uploaded string, stored int, err error) {
+	local, err := bs.ListBackups()
+	if err != nil {
+		return "", 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.pushTimeout())
+	defer cancel()
+	defer func() {
+		if err != nil && ctx.Err() != nil {
+			err = fmt.Errorf("timed out after %s: %w", cfg.pushTimeout(), err)
+		}
+	}()
+
+	dest, err := cfg.open(ctx)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to connect: %w", err)
+	}
+	defer dest.Close()
+
+	names, err := dest.List()
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to list: %w", err)
+	}
+	remote := make(map[string]bool, len(names))
+	for _, name := range names {
+		remote[name] = true
+	}
+
+	cutoff := retentionCutoff(cfg.RetentionDays)
+
+	// Oldest first, so an interrupted push leaves the newest missing and
+	// retries it next time. A backup counts as stored once its manifest is.
+	sort.Slice(local, func(i, j int) bool { return local[i].Name < local[j].Name })
+	for _, backup := range local {
+		if backup.Manifest == nil || remote[backup.Name+manifestExt] || backupTime(backup.Name).Before(cutoff) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return uploaded, 0, err
+		}
+		backupPath := filepath.Join(bs.backupDir, backup.Name)
+		if err := putFile(dest, backupPath, backup.Name); err != nil {
+			return uploaded, 0, fmt.Errorf("failed to upload %s: %w", backup.Name, err)
+		}
+		if err := putFile(dest, manifestPath(backupPath), backup.Name+manifestExt); err != nil {
+			return uploaded, 0, fmt.Errorf("failed to upload the manifest of %s: %w", backup.Name, err)
+		}
+		remote[backup.Name] = true
+		remote[backup.Name+manifestExt] = true
+		uploaded = backup.Name
+		log.Printf("📤 Backup %s uploaded to %s", backup.Name, cfg.Name)
+	}
+
+	for name := range remote {
+		backupName := strings.TrimSuffix(name, manifestExt)
+		if !isBackupName(backupName) {
+			continue
+		}
+		if !backupTime(backupName).Before(cutoff) {
+			if name == backupName && remote[backupName+manifestExt] {
+				stored++
+			}
+			continue
+		}
+		if err := dest.Delete(name); err != nil {
+			return uploaded, 0, fmt.Errorf("failed to delete %s: %w", name, err)
+		}
+		if name == backupName {
+			log.Printf("🧹 Expired backup %s deleted from %s", name, cfg.Name)
+		}
+	}
+	return uploaded, stored, nil
+}
+
+// putFile uploads a local file
+func putFile(dest BackupDestination, path, name string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	return dest.Put(name, file, info.Size())
+}
+
+// retentionCutoff returns the time before which backups expire, or the
+// zero time when they are kept forever
+func retentionCutoff(days int) time.Time {
+	if days <= 0 {
+		return time.Time{}
+	}
+	return time.Now().AddDate(0, 0, -days)
+}
+
+// backupTime returns when a backup was made, from its name. Names that do
+// not parse give the zero time.
+func backupTime(name string) time.Time {
+	stamp := strings.TrimPrefix(name, backupPrefix)
+	if len(stamp) < len(backupTimeLayout) {
+		return time.Time{}
+	}
+	t, err := time.ParseInLocation(backupTimeLayout, stamp[:len(backupTimeLayout)], time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// directoryDestination copies backups to another directory
+type directoryDestination struct {
+	dir string
+}
+
+func openDirectoryDestination(cfg DestinationConfig) (BackupDestination, error) {
+	if err := os.MkdirAll(cfg.Path, 0700); err != nil {
+		return nil, err
+	}
+	return &directoryDestination{dir: cfg.Path}, nil
+}
+
+func (d *directoryDestination) Put(name string, r io.Reader, size int64) error {
+	partial := filepath.Join(d.dir, name+partialExt)
+	file, err := os.OpenFile(partial, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		os.Remove(partial)
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(partial)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(partial)
+		return err
+	}
+	return os.Rename(partial, filepath.Join(d.dir, name))
+}
+
+func (d *directoryDestination) List() ([]string, error) {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+func (d *directoryDestination) Delete(name string) error {
+	return os.Remove(filepath.Join(d.dir, name))
+}
+
+func (d *directoryDestination) Close() error {
+	return nil
+}
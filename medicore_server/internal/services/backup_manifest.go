@@ -0,0 +1,112 @@
+package services
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// manifestExt is appended to a backup file name to get its manifest
+const manifestExt = ".manifest.json"
+
+// BackupManifest describes the content of a backup. It is written next to
+// the backup and checked before the backup is restored.
+type BackupManifest struct {
+	Name          string           `json:"name"`
+	CreatedAt     time.Time        `json:"created_at"`
+	Size          int64            `json:"size"`
+	SHA256        string           `json:"sha256"` // Of the backup file, as stored
+	Encrypted     bool             `json:"encrypted"`
+	SchemaVersion int              `json:"schema_version"` // Last migration applied
+	RowCounts     map[string]int64 `json:"row_counts"`     // Rows of each table in the dump
+}
+
+// manifestPath returns the path of the manifest of a backup
+func manifestPath(backupPath string) string {
+	return backupPath + manifestExt
+}
+
+// readManifest reads the manifest of a backup
+func readManifest(backupPath string) (*BackupManifest, error) {
+	data, err := os.ReadFile(manifestPath(backupPath))
+	if err != nil {
+		return nil, err
+	}
+	var manifest BackupManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid backup manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// writeManifest writes the manifest of a backup
+func writeManifest(backupPath string, manifest *BackupManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(manifestPath(backupPath), data, 0600)
+}
+
+// fileChecksum returns the hex SHA-256 of a file
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// snapshotContent fills the schema version and row counts of a manifest.
+// tx must see the same snapshot as the dump.
+func snapshotContent(tx *sql.Tx, manifest *BackupManifest) error {
+	err := tx.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&manifest.SchemaVersion)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	rows, err := tx.Query(`
+		SELECT table_name FROM information_schema.tables
+		WHERE table_schema = 'public' AND table_type = 'BASE TABLE'
+		ORDER BY table_name
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to list tables: %w", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			rows.Close()
+			return err
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	manifest.RowCounts = make(map[string]int64, len(tables))
+	for _, table := range tables {
+		var count int64
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM ` + pq.QuoteIdentifier(table)).Scan(&count); err != nil {
+			return fmt.Errorf("failed to count %s: %w", table, err)
+		}
+		manifest.RowCounts[table] = count
+	}
+	return nil
+}
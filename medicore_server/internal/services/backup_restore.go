@@ -0,0 +1,383 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/lib/pq"
+
+	"medicore/internal/repository"
+)
+
+// maintenanceDB is the database used to rename the others
+const maintenanceDB = "postgres"
+
+var (
+	// ErrRestoreNotConfigured is returned when staged restores were not
+	// enabled with EnableStagedRestore
+	ErrRestoreNotConfigured = errors.New("restore is not configured")
+	// ErrNoRollback is returned when there is no restore to roll back
+	ErrNoRollback = errors.New("no restore to roll back")
+	// ErrRestoreInvalid is returned when a restored database fails its
+	// checks; the live database is left untouched
+	ErrRestoreInvalid = errors.New("restored database failed its checks")
+)
+
+// RestoreConfig is what a staged restore needs besides the backup service
+type RestoreConfig struct {
+	ConnString   func(dbName string) string // Connection string to another database of the server
+	MaxIdleConns int                        // Idle connections of the server pool, dropped during the switch
+	Prepare      func(db *sql.DB) error     // Brings a restored database up to the current schema
+}
+
+// RestoreResult describes a restore or a rollback
+type RestoreResult struct {
+	Backup           string              `json:"backup,omitempty"`
+	Snapshot         string              `json:"snapshot,omitempty"`          // Backup of the data that was replaced
+	RollbackDatabase string              `json:"rollback_database,omitempty"` // Database holding the data that was replaced
+	SwitchedAt       time.Time           `json:"switched_at"`
+	Checks           []VerificationCheck `json:"checks,omitempty"`
+}
+
+// EnableStagedRestore makes RestoreBackup and RollbackRestore available.
+// The database user needs the CREATEDB privilege and to own the database.
+func (bs *BackupService) EnableStagedRestore(cfg RestoreConfig) {
+	bs.restore = &cfg
+}
+
+// rollbackName is the database holding the data replaced by the last restore
+func (bs *BackupService) rollbackName() string {
+	return bs.dbName + "_pre_restore"
+}
+
+// RestoreBackup replaces the live database with a backup, in stages:
+//  1. the current data is backed up (the snapshot),
+//  2. the backup is verified and restored into a new database,
+//  3. the new database is checked against the manifest and migrated,
+//  4. pause is called, the live sessions are copied to the new database, the
+//     databases are swapped by renaming them, and the function returned by
+//     pause is called with the error of the swap.
+//
+// The live database is only touched in the last stage, which takes a few
+// seconds. The replaced database is kept for RollbackRestore until the next
+// restore. pause should stop serving requests until the returned function
+// is called.
+func (bs *BackupService) RestoreBackup(backupFilename string, pause func() (resume func(error))) (*RestoreResult, error) {
+	if bs.restore == nil {
+		return nil, ErrRestoreNotConfigured
+	}
+	backupPath, err := bs.backupPath(backupFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bs.busy.TryLock() {
+		return nil, ErrBackupBusy
+	}
+	defer bs.busy.Unlock()
+
+	manifest, err := bs.verify(backupPath)
+	if err != nil {
+		log.Printf("❌ Refusing to restore %s: %v", backupFilename, err)
+		return nil, err
+	}
+
+	log.Printf("🔄 Restoring from backup: %s", backupFilename)
+	result := &RestoreResult{Backup: backupFilename}
+
+	// 1. Snapshot of the current data
+	snapshotPath, err := bs.runBackup()
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot the current data: %w", err)
+	}
+	result.Snapshot = filepath.Base(snapshotPath)
+	log.Printf("📸 Current data saved as %s", result.Snapshot)
+
+	// 2. Restore into a new database
+	staged := fmt.Sprintf("%s_restore_%d", bs.dbName, time.Now().Unix())
+	if _, err := bs.db.Exec(`CREATE DATABASE ` + pq.QuoteIdentifier(staged)); err != nil {
+		return nil, fmt.Errorf("failed to create the restore database: %w", err)
+	}
+	switched := false
+	defer func() {
+		if !switched {
+			bs.dropDatabase(staged)
+		}
+	}()
+	if err := bs.restoreInto(backupPath, staged); err != nil {
+		return nil, err
+	}
+
+	// 3. Validate and migrate
+	if err := bs.prepareRestored(result, manifest, staged); err != nil {
+		return result, err
+	}
+
+	// 4. Switch
+	bs.dropDatabase(bs.rollbackName())
+	resume := pause()
+	bs.carrySessions(staged)
+	err = bs.swapDatabases(staged, bs.rollbackName())
+	resume(err)
+	if err != nil {
+		return result, err
+	}
+	switched = true
+	result.RollbackDatabase = bs.rollbackName()
+	result.SwitchedAt = time.Now()
+
+	log.Printf("✅ Backup %s restored, previous data kept in database %s", backupFilename, result.RollbackDatabase)
+	return result, nil
+}
+
+// prepareRestored checks a restored database against its manifest, brings
+// it up to the current schema and makes clients resync from scratch
+func (bs *BackupService) prepareRestored(result *RestoreResult, manifest *BackupManifest, dbName string) error {
+	restored, err := sql.Open("postgres", bs.restore.ConnString(dbName))
+	if err != nil {
+		return err
+	}
+	defer restored.Close()
+
+	checks := &BackupVerification{}
+	checkManifest(checks, manifest, restored)
+	result.Checks = checks.Checks
+	if checks.Error != "" {
+		return fmt.Errorf("%w: %s", ErrRestoreInvalid, checks.Error)
+	}
+
+	if bs.restore.Prepare != nil {
+		if err := bs.restore.Prepare(restored); err != nil {
+			return fmt.Errorf("failed to migrate the restored database: %w", err)
+		}
+	}
+
+	var liveVersion, restoredVersion int
+	if err := bs.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&liveVersion); err != nil {
+		return err
+	}
+	if err := restored.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&restoredVersion); err != nil {
+		return err
+	}
+	checks.check("schema_migrations (live)", liveVersion, restoredVersion, restoredVersion == liveVersion)
+	result.Checks = checks.Checks
+	if checks.Error != "" {
+		return fmt.Errorf("%w: %s", ErrRestoreInvalid, checks.Error)
+	}
+
+	return repository.NewSyncRepository(restored).ForceFullSync()
+}
+
+// RollbackRestore puts back the data replaced by the last restore. The
+// restored data is kept in its place, so the rollback can itself be undone
+// by calling RollbackRestore again. pause works as for RestoreBackup.
+func (bs *BackupService) RollbackRestore(pause func() (resume func(error))) (*RestoreResult, error) {
+	if bs.restore == nil {
+		return nil, ErrRestoreNotConfigured
+	}
+	if !bs.busy.TryLock() {
+		return nil, ErrBackupBusy
+	}
+	defer bs.busy.Unlock()
+
+	var exists bool
+	err := bs.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)`, bs.rollbackName()).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNoRollback
+	}
+
+	// The live database takes a temporary name, then the rollback one
+	undone := fmt.Sprintf("%s_undone_%d", bs.dbName, time.Now().Unix())
+	resume := pause()
+	bs.carrySessions(bs.rollbackName())
+	err = bs.swapDatabases(bs.rollbackName(), undone)
+	resume(err)
+	if err != nil {
+		return nil, err
+	}
+	if err := bs.renameDatabase(undone, bs.rollbackName()); err != nil {
+		log.Printf("⚠️ Replaced data kept in database %s: %v", undone, err)
+		return &RestoreResult{RollbackDatabase: undone, SwitchedAt: time.Now()}, nil
+	}
+
+	log.Printf("↩️ Restore rolled back, restored data kept in database %s", bs.rollbackName())
+	return &RestoreResult{RollbackDatabase: bs.rollbackName(), SwitchedAt: time.Now()}, nil
+}
+
+// carrySessions replaces the sessions of another database with the live
+// ones, so switching to it neither logs users out nor brings back revoked
+// sessions. Sessions of users the database does not have are dropped. Call
+// it while requests are paused: sessions opened afterwards would be lost.
+func (bs *BackupService) carrySessions(dbName string) {
+	if err := bs.copySessions(dbName); err != nil {
+		log.Printf("⚠️ Sessions not carried over to database %s, users will log in again: %v", dbName, err)
+	}
+}
+
+func (bs *BackupService) copySessions(dbName string) error {
+	rows, err := bs.db.Query(`
+		SELECT id, user_id, token, ip_address, user_agent, created_at, expires_at, last_activity
+		FROM sessions WHERE expires_at > NOW()
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type session struct {
+		id, userID, token       string
+		ipAddress, userAgent    sql.NullString
+		createdAt, lastActivity sql.NullTime
+		expiresAt               time.Time
+	}
+	sessions := []session{}
+	for rows.Next() {
+		var s session
+		if err := rows.Scan(&s.id, &s.userID, &s.token, &s.ipAddress, &s.userAgent, &s.createdAt, &s.expiresAt, &s.lastActivity); err != nil {
+			return err
+		}
+		sessions = append(sessions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	target, err := sql.Open("postgres", bs.restore.ConnString(dbName))
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+
+	return repository.InTx(target, func(tx repository.DBTX) error {
+		if _, err := tx.Exec(`DELETE FROM sessions`); err != nil {
+			return err
+		}
+		for _, s := range sessions {
+			_, err := tx.Exec(`
+				INSERT INTO sessions (id, user_id, token, ip_address, user_agent, created_at, expires_at, last_activity)
+				SELECT $1::uuid, $2::varchar, $3, $4, $5, $6::timestamptz, $7::timestamptz, $8::timestamptz
+				WHERE EXISTS (SELECT 1 FROM users WHERE id = $2::varchar)
+			`, s.id, s.userID, s.token, s.ipAddress, s.userAgent, s.createdAt, s.expiresAt, s.lastActivity)
+			if err != nil {
+				return fmt.Errorf("copy session of user %s: %w", s.userID, err)
+			}
+		}
+		return nil
+	})
+}
+
+// swapDatabases makes next the live database, renaming the live one to
+// previous. Every connection to the live database is closed, those of the
+// server pool included: the pool reconnects to the new live database.
+func (bs *BackupService) swapDatabases(next, previous string) error {
+	admin, err := sql.Open("postgres", bs.restore.ConnString(maintenanceDB))
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+
+	live := pq.QuoteIdentifier(bs.dbName)
+	allowConnections := func(name string) {
+		if _, err := admin.Exec(`ALTER DATABASE ` + pq.QuoteIdentifier(name) + ` ALLOW_CONNECTIONS true`); err != nil {
+			log.Printf("⚠️ Failed to reopen database %s: %v", name, err)
+		}
+	}
+
+	bs.db.SetMaxIdleConns(0)
+	defer bs.db.SetMaxIdleConns(bs.restore.MaxIdleConns)
+
+	if _, err := admin.Exec(`ALTER DATABASE ` + live + ` ALLOW_CONNECTIONS false`); err != nil {
+		return fmt.Errorf("failed to close the live database: %w", err)
+	}
+
+	// Terminated connections take a moment to go away
+	err = nil
+	for attempt := 0; attempt < 20; attempt++ {
+		_, err = admin.Exec(`
+			SELECT pg_terminate_backend(pid) FROM pg_stat_activity
+			WHERE datname = $1 AND pid <> pg_backend_pid()
+		`, bs.dbName)
+		if err == nil {
+			_, err = admin.Exec(`ALTER DATABASE ` + live + ` RENAME TO ` + pq.QuoteIdentifier(previous))
+		}
+		if err == nil {
+			break
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+	if err != nil {
+		allowConnections(bs.dbName)
+		return fmt.Errorf("failed to rename the live database: %w", err)
+	}
+
+	if _, err := admin.Exec(`ALTER DATABASE ` + pq.QuoteIdentifier(next) + ` RENAME TO ` + live); err != nil {
+		// Put the live database back
+		if _, undoErr := admin.Exec(`ALTER DATABASE ` + pq.QuoteIdentifier(previous) + ` RENAME TO ` + live); undoErr != nil {
+			log.Printf("❌ Failed to put back the live database, it is named %s: %v", previous, undoErr)
+		}
+		allowConnections(bs.dbName)
+		return fmt.Errorf("failed to rename the restored database: %w", err)
+	}
+
+	allowConnections(bs.dbName)
+	allowConnections(previous)
+	return nil
+}
+
+// renameDatabase renames a database nobody is connected to
+func (bs *BackupService) renameDatabase(from, to string) error {
+	admin, err := sql.Open("postgres", bs.restore.ConnString(maintenanceDB))
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+	_, err = admin.Exec(`ALTER DATABASE ` + pq.QuoteIdentifier(from) + ` RENAME TO ` + pq.QuoteIdentifier(to))
+	return err
+}
+
+// dropDatabase drops a database other than the live one, if it exists
+func (bs *BackupService) dropDatabase(name string) {
+	if name == bs.dbName {
+		return
+	}
+	if _, err := bs.db.Exec(`DROP DATABASE IF EXISTS ` + pq.QuoteIdentifier(name)); err != nil {
+		log.Printf("⚠️ Failed to drop database %s: %v", name, err)
+	}
+}
+
+// restoreInto restores a backup into another database of the server, in a
+// single transaction stopping at the first error
+func (bs *BackupService) restoreInto(backupPath, dbName string) error {
+	dump, err := bs.openDump(backupPath)
+	if err != nil {
+		return err
+	}
+	defer dump.Close()
+
+	psqlCmd := exec.Command(
+		"psql",
+		"-h", bs.dbHost,
+		"-p", fmt.Sprintf("%d", bs.dbPort),
+		"-U", bs.dbUser,
+		"-d", dbName,
+		"-v", "ON_ERROR_STOP=1",
+		"--single-transaction",
+		"-q",
+	)
+	psqlCmd.Env = append(os.Environ(), fmt.Sprintf("PGPASSWORD=%s", bs.dbPassword))
+	psqlCmd.Stdin = dump
+
+	if output, err := psqlCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("psql failed: %w: %s", err, lastLine(output))
+	}
+	return nil
+}
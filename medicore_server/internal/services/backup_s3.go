@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// s3Destination copies backups to a bucket of an S3-compatible object
+// storage, such as AWS S3 or MinIO, under a key prefix
+type s3Destination struct {
+	ctx    context.Context // Context of the push, bounding every request
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func openS3Destination(ctx context.Context, cfg DestinationConfig) (BackupDestination, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := strings.Trim(cfg.Path, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &s3Destination{ctx: ctx, client: client, bucket: cfg.Bucket, prefix: prefix}, nil
+}
+
+func (d *s3Destination) Put(name string, r io.Reader, size int64) error {
+	_, err := d.client.PutObject(d.ctx, d.bucket, d.prefix+name, r, size, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	})
+	return err
+}
+
+func (d *s3Destination) List() ([]string, error) {
+	names := []string{}
+	for object := range d.client.ListObjects(d.ctx, d.bucket, minio.ListObjectsOptions{Prefix: d.prefix}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		name := strings.TrimPrefix(object.Key, d.prefix)
+		if name != "" && !strings.Contains(name, "/") {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (d *s3Destination) Delete(name string) error {
+	return d.client.RemoveObject(d.ctx, d.bucket, d.prefix+name, minio.RemoveObjectOptions{})
+}
+
+func (d *s3Destination) Close() error {
+	return nil
+}
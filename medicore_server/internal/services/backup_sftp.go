@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sftpDestination copies backups to a directory of an SFTP server
+type sftpDestination struct {
+	conn    *ssh.Client
+	client  *sftp.Client
+	dir     string
+	unwatch func() bool // Stops closing the connection when the push times out
+}
+
+func openSFTPDestination(ctx context.Context, cfg DestinationConfig) (BackupDestination, error) {
+	var auth []ssh.AuthMethod
+	if cfg.PrivateKeyFile != "" {
+		key, err := os.ReadFile(cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private key: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if cfg.Password != "" {
+		auth = append(auth, ssh.Password(cfg.Password))
+	}
+
+	hostKey := ssh.InsecureIgnoreHostKey()
+	if !cfg.InsecureIgnoreHostKey {
+		var err error
+		if hostKey, err = knownhosts.New(cfg.KnownHostsFile); err != nil {
+			return nil, fmt.Errorf("failed to read known hosts: %w", err)
+		}
+	}
+
+	dialer := net.Dialer{Timeout: destinationDialTimeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", cfg.Host)
+	if err != nil {
+		return nil, err
+	}
+	// SFTP calls take no context: closing the connection makes whatever is
+	// in progress fail once the push times out
+	unwatch := context.AfterFunc(ctx, func() { netConn.Close() })
+
+	netConn.SetDeadline(time.Now().Add(destinationDialTimeout))
+	sshConn, chans, reqs, err := ssh.NewClientConn(netConn, cfg.Host, &ssh.ClientConfig{
+		User:            cfg.User,
+		Auth:            auth,
+		HostKeyCallback: hostKey,
+	})
+	if err != nil {
+		unwatch()
+		netConn.Close()
+		return nil, err
+	}
+	netConn.SetDeadline(time.Time{})
+	conn := ssh.NewClient(sshConn, chans, reqs)
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		unwatch()
+		conn.Close()
+		return nil, err
+	}
+
+	dir := cfg.Path
+	if dir == "" {
+		dir = "."
+	}
+	if err := client.MkdirAll(dir); err != nil {
+		unwatch()
+		client.Close()
+		conn.Close()
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	return &sftpDestination{conn: conn, client: client, dir: dir, unwatch: unwatch}, nil
+}
+
+func (d *sftpDestination) Put(name string, r io.Reader, size int64) error {
+	partial := path.Join(d.dir, name+partialExt)
+	file, err := d.client.Create(partial)
+	if err != nil {
+		return err
+	}
+	if _, err := file.ReadFrom(r); err != nil {
+		file.Close()
+		d.client.Remove(partial)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		d.client.Remove(partial)
+		return err
+	}
+
+	target := path.Join(d.dir, name)
+	if err := d.client.PosixRename(partial, target); err != nil {
+		// Servers without the posix-rename extension cannot replace a file
+		d.client.Remove(target)
+		return d.client.Rename(partial, target)
+	}
+	return nil
+}
+
+func (d *sftpDestination) List() ([]string, error) {
+	entries, err := d.client.ReadDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+func (d *sftpDestination) Delete(name string) error {
+	return d.client.Remove(path.Join(d.dir, name))
+}
+
+func (d *sftpDestination) Close() error {
+	d.unwatch()
+	d.client.Close()
+	return d.conn.Close()
+}
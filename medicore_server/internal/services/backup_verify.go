@@ -0,0 +1,280 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// verificationExt is appended to a backup file name to get its last
+// verification
+const verificationExt = ".verification.json"
+
+// BackupVerification is the result of test-restoring a backup
+type BackupVerification struct {
+	Backup     string              `json:"backup"`
+	VerifiedAt time.Time           `json:"verified_at"`
+	Passed     bool                `json:"passed"`
+	Error      string              `json:"error,omitempty"` // First failure
+	Checks     []VerificationCheck `json:"checks"`
+}
+
+// VerificationCheck is one sanity check of a verification
+type VerificationCheck struct {
+	Name     string `json:"name"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+	Passed   bool   `json:"passed"`
+}
+
+// check records a check, and the verification failure if it is the first
+func (v *BackupVerification) check(name string, expected, actual interface{}, passed bool) {
+	v.Checks = append(v.Checks, VerificationCheck{
+		Name:     name,
+		Expected: fmt.Sprint(expected),
+		Actual:   fmt.Sprint(actual),
+		Passed:   passed,
+	})
+	if !passed && v.Error == "" {
+		v.Error = fmt.Sprintf("%s: expected %v, got %v", name, expected, actual)
+	}
+}
+
+// fail records a failure that stops the verification
+func (v *BackupVerification) fail(name string, err error) {
+	v.Checks = append(v.Checks, VerificationCheck{Name: name, Actual: err.Error()})
+	if v.Error == "" {
+		v.Error = fmt.Sprintf("%s: %v", name, err)
+	}
+}
+
+// BackupVerifier test-restores new backups into a scratch database and
+// compares the restored data with the backup manifest and the live
+// database. The database user needs the CREATEDB privilege.
+type BackupVerifier struct {
+	backups    *BackupService
+	db         *sql.DB
+	connString func(dbName string) string // Connection string to another database of the server
+
+	queue    chan string
+	mutex    sync.Mutex // Serializes verifications
+	onResult []func(BackupVerification)
+}
+
+// NewBackupVerifier creates a verifier for the backups of a service.
+// connString returns the connection string of a database of the same
+// server, by name.
+func NewBackupVerifier(backups *BackupService, db *sql.DB, connString func(dbName string) string) *BackupVerifier {
+	return &BackupVerifier{
+		backups:    backups,
+		db:         db,
+		connString: connString,
+		queue:      make(chan string, 10),
+	}
+}
+
+// OnResult registers a function called with every verification result
+func (bv *BackupVerifier) OnResult(fn func(BackupVerification)) {
+	bv.onResult = append(bv.onResult, fn)
+}
+
+// Enqueue schedules the verification of a backup
+func (bv *BackupVerifier) Enqueue(backupFilename string) {
+	select {
+	case bv.queue <- backupFilename:
+	default:
+		log.Printf("⚠️ Backup verification queue full, not verifying %s", backupFilename)
+	}
+}
+
+// Run verifies the queued backups
+func (bv *BackupVerifier) Run() {
+	log.Println("⏰ Backup verifier started")
+	for backupFilename := range bv.queue {
+		bv.Verify(backupFilename)
+	}
+}
+
+// Verify test-restores a backup, records the result next to the backup and
+// returns it. It fails only when the backup cannot be found; a bad backup
+// gives a result that did not pass.
+func (bv *BackupVerifier) Verify(backupFilename string) (*BackupVerification, error) {
+	backupPath, err := bv.backups.backupPath(backupFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	bv.mutex.Lock()
+	defer bv.mutex.Unlock()
+
+	log.Printf("🔍 Verifying backup: %s", backupFilename)
+	result := bv.verify(backupPath, backupFilename)
+	result.Passed = result.Error == ""
+	if result.Passed {
+		log.Printf("✅ Backup verified: %s", backupFilename)
+	} else {
+		log.Printf("❌ Backup verification failed for %s: %s", backupFilename, result.Error)
+	}
+
+	if err := writeVerification(backupPath, result); err != nil {
+		log.Printf("⚠️ Failed to record verification of %s: %v", backupFilename, err)
+	}
+	bv.backups.setVerification(result)
+	for _, fn := range bv.onResult {
+		fn(*result)
+	}
+	return result, nil
+}
+
+// verify runs the checks of a backup
+func (bv *BackupVerifier) verify(backupPath, backupFilename string) *BackupVerification {
+	result := &BackupVerification{Backup: backupFilename, VerifiedAt: time.Now(), Checks: []VerificationCheck{}}
+
+	manifest, err := bv.backups.verify(backupPath)
+	if err != nil {
+		result.fail("integrity", err)
+		return result
+	}
+	result.check("integrity", "checksum and decryption ok", "checksum and decryption ok", true)
+
+	scratchName := fmt.Sprintf("%s_verify_%d", bv.backups.dbName, time.Now().UnixNano())
+	if _, err := bv.db.Exec(`CREATE DATABASE ` + pq.QuoteIdentifier(scratchName)); err != nil {
+		result.fail("scratch database", err)
+		return result
+	}
+	defer func() {
+		if _, err := bv.db.Exec(`DROP DATABASE IF EXISTS ` + pq.QuoteIdentifier(scratchName)); err != nil {
+			log.Printf("⚠️ Failed to drop scratch database %s: %v", scratchName, err)
+		}
+	}()
+
+	if err := bv.backups.restoreInto(backupPath, scratchName); err != nil {
+		result.fail("restore", err)
+		return result
+	}
+	result.check("restore", "restored", "restored", true)
+
+	scratch, err := sql.Open("postgres", bv.connString(scratchName))
+	if err != nil {
+		result.fail("scratch connection", err)
+		return result
+	}
+	defer scratch.Close()
+
+	counts := checkManifest(result, manifest, scratch)
+	bv.checkLive(result, manifest, counts, scratch)
+	return result
+}
+
+// checkManifest checks a restored database against the manifest of its
+// backup: the last migration and the rows of every table must match. It
+// returns the restored row counts.
+func checkManifest(result *BackupVerification, manifest *BackupManifest, restored *sql.DB) map[string]int64 {
+	var migration int
+	if err := restored.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&migration); err != nil {
+		result.fail("schema_migrations", err)
+	} else {
+		result.check("schema_migrations", manifest.SchemaVersion, migration, migration == manifest.SchemaVersion)
+	}
+
+	tables := make([]string, 0, len(manifest.RowCounts))
+	for table := range manifest.RowCounts {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	counts := make(map[string]int64, len(tables))
+	for _, table := range tables {
+		expected := manifest.RowCounts[table]
+		var count int64
+		if err := restored.QueryRow(`SELECT COUNT(*) FROM ` + pq.QuoteIdentifier(table)).Scan(&count); err != nil {
+			result.fail("rows of "+table, err)
+			continue
+		}
+		result.check("rows of "+table, expected, count, count == expected)
+		counts[table] = count
+	}
+	return counts
+}
+
+// checkLive checks a restored database against the live one. The live
+// database has moved on since the backup, so besides a different
+// schema_version it only looks for tables that had rows both in the backup
+// and live but came back empty. Tables empty at backup time, or created
+// since, are not compared.
+func (bv *BackupVerifier) checkLive(result *BackupVerification, manifest *BackupManifest, counts map[string]int64, restored *sql.DB) {
+	var liveVersion, restoredVersion string
+	if err := bv.db.QueryRow(`SELECT value_text FROM app_metadata WHERE key = 'schema_version'`).Scan(&liveVersion); err != nil {
+		result.fail("app_metadata schema_version (live)", err)
+	} else if err := restored.QueryRow(`SELECT value_text FROM app_metadata WHERE key = 'schema_version'`).Scan(&restoredVersion); err != nil {
+		result.fail("app_metadata schema_version", err)
+	} else {
+		result.check("app_metadata schema_version", liveVersion, restoredVersion, liveVersion == restoredVersion)
+	}
+
+	live := &BackupManifest{}
+	tx, err := bv.db.Begin()
+	if err == nil {
+		err = snapshotContent(tx, live)
+		tx.Rollback()
+	}
+	if err != nil {
+		result.fail("live row counts", err)
+		return
+	}
+
+	tables := make([]string, 0, len(manifest.RowCounts))
+	for table := range manifest.RowCounts {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		count, restoredOK := counts[table]
+		if !restoredOK || manifest.RowCounts[table] == 0 || live.RowCounts[table] == 0 {
+			continue
+		}
+		result.check("rows of "+table+" (live)", fmt.Sprintf("> 0 (live: %d)", live.RowCounts[table]), count, count > 0)
+	}
+}
+
+// lastLine returns the last non-empty line of a command output
+func lastLine(output []byte) string {
+	end := len(output)
+	for end > 0 && (output[end-1] == '\n' || output[end-1] == '\r') {
+		end--
+	}
+	start := end
+	for start > 0 && output[start-1] != '\n' {
+		start--
+	}
+	return string(output[start:end])
+}
+
+// readVerification reads the last verification of a backup
+func readVerification(backupPath string) (*BackupVerification, error) {
+	data, err := os.ReadFile(backupPath + verificationExt)
+	if err != nil {
+		return nil, err
+	}
+	var verification BackupVerification
+	if err := json.Unmarshal(data, &verification); err != nil {
+		return nil, err
+	}
+	return &verification, nil
+}
+
+// writeVerification records the verification of a backup
+func writeVerification(backupPath string, verification *BackupVerification) error {
+	data, err := json.MarshalIndent(verification, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(backupPath+verificationExt, data, 0600)
+}
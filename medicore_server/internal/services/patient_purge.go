@@ -0,0 +1,87 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"medicore/internal/repository"
+)
+
+// DefaultPatientRetentionDays is how long a deleted patient can be restored
+// before it is purged, when PATIENT_RETENTION_DAYS is not set
+const DefaultPatientRetentionDays = 30
+
+// PatientPurgeService permanently removes patients that were deleted longer
+// than the retention period ago
+type PatientPurgeService struct {
+	db        *sql.DB
+	audit     *AuditService
+	retention int // Number of days a deleted patient is kept
+}
+
+// NewPatientPurgeService creates a new purge service. A retention of 0 or
+// less keeps deleted patients forever.
+func NewPatientPurgeService(db *sql.DB, retention int) *PatientPurgeService {
+	return &PatientPurgeService{
+		db:        db,
+		audit:     NewAuditService(db),
+		retention: retention,
+	}
+}
+
+// Purge removes the expired patients and their related data in a single
+// transaction and returns how many patients were removed
+func (ps *PatientPurgeService) Purge() (int, error) {
+	if ps.retention <= 0 {
+		return 0, nil
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -ps.retention)
+	var codes []int
+	err := repository.InTx(ps.db, func(tx repository.DBTX) error {
+		var err error
+		codes, err = repository.NewPatientRepository(tx).Purge(cutoff)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge deleted patients: %w", err)
+	}
+
+	for _, code := range codes {
+		err := ps.audit.Record(AuditEntry{
+			Action:    AuditPurge,
+			TableName: "patients",
+			RecordID:  fmt.Sprint(code),
+		})
+		if err != nil {
+			log.Printf("⚠️ %v", err)
+		}
+	}
+
+	if len(codes) > 0 {
+		log.Printf("🗑️ Purged %d patients deleted more than %d days ago", len(codes), ps.retention)
+	}
+	return len(codes), nil
+}
+
+// SchedulePurge purges expired patients on a schedule
+func (ps *PatientPurgeService) SchedulePurge(interval time.Duration) {
+	if ps.retention <= 0 {
+		log.Println("ℹ️ Patient purge disabled: deleted patients are kept forever")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	log.Printf("⏰ Patient purge scheduler started (interval: %v, retention: %d days)", interval, ps.retention)
+
+	for {
+		if _, err := ps.Purge(); err != nil {
+			log.Printf("❌ Scheduled patient purge failed: %v", err)
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,173 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"medicore/internal/models"
+)
+
+// FieldError describes why one request field is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors lists the invalid fields of a request
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	parts := make([]string, len(e))
+	for i, fe := range e {
+		parts[i] = fe.Field + ": " + fe.Message
+	}
+	return "invalid request: " + strings.Join(parts, "; ")
+}
+
+// Validatable is implemented by request bodies that check their own fields
+type Validatable interface {
+	Validate(v *Validator)
+}
+
+// Validator collects field errors while a request is checked. Only the
+// first error of each field is kept.
+type Validator struct {
+	errors Errors
+}
+
+// Validate runs the checks of a request and returns Errors, or nil when
+// the request is valid
+func Validate(req Validatable) error {
+	v := &Validator{}
+	req.Validate(v)
+	return v.Err()
+}
+
+// Err returns the collected Errors, or nil when there are none
+func (v *Validator) Err() error {
+	if len(v.errors) == 0 {
+		return nil
+	}
+	return v.errors
+}
+
+// Add records an error for a field
+func (v *Validator) Add(field, message string) {
+	for _, fe := range v.errors {
+		if fe.Field == field {
+			return
+		}
+	}
+	v.errors = append(v.errors, FieldError{Field: field, Message: message})
+}
+
+// Check records an error for a field when ok is false
+func (v *Validator) Check(ok bool, field, message string) {
+	if !ok {
+		v.Add(field, message)
+	}
+}
+
+// Required checks that a string field is not blank
+func (v *Validator) Required(field, value string) {
+	v.Check(strings.TrimSpace(value) != "", field, "is required")
+}
+
+// RequiredID checks that an id or code field is set
+func (v *Validator) RequiredID(field string, id int64) {
+	v.Check(id > 0, field, "is required")
+}
+
+// Min checks that a number is at least min
+func (v *Validator) Min(field string, value, min int64) {
+	v.Check(value >= min, field, fmt.Sprintf("must be at least %d", min))
+}
+
+// Range checks that a number is between min and max, inclusive
+func (v *Validator) Range(field string, value, min, max int64) {
+	v.Check(value >= min && value <= max, field, fmt.Sprintf("must be between %d and %d", min, max))
+}
+
+// MaxLength checks that a string is at most max characters long
+func (v *Validator) MaxLength(field, value string, max int) {
+	v.Check(len([]rune(value)) <= max, field, fmt.Sprintf("must be at most %d characters", max))
+}
+
+// OneOf checks that a string is one of the allowed values
+func (v *Validator) OneOf(field, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.Add(field, "must be one of "+strings.Join(allowed, ", "))
+}
+
+// Time checks that a decoded date field held a valid date
+func (v *Validator) Time(field string, t models.Timestamp) {
+	v.Check(!t.Invalid(), field, "must be a date (YYYY-MM-DD or RFC3339)")
+}
+
+// RequiredTime checks that a decoded date field holds a valid date
+func (v *Validator) RequiredTime(field string, t models.Timestamp) {
+	v.Time(field, t)
+	v.Check(!t.IsZero(), field, "is required")
+}
+
+// Date checks that a string is a date in one of the formats accepted by
+// models.ParseTime. Empty strings are accepted; combine with Required.
+func (v *Validator) Date(field, value string) {
+	if value == "" {
+		return
+	}
+	if _, err := models.ParseTime(value); err != nil {
+		v.Add(field, "must be a date (YYYY-MM-DD or RFC3339)")
+	}
+}
+
+// DecodeError converts an error from decoding a JSON body into Errors so
+// type mismatches are reported per field
+func DecodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &typeErr):
+		field := typeErr.Field
+		if field == "" {
+			field = "body"
+		}
+		return Errors{{Field: field, Message: typeMessage(typeErr.Type)}}
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return Errors{{Field: "body", Message: "is not valid JSON"}}
+	case errors.Is(err, io.EOF):
+		return Errors{{Field: "body", Message: "is required"}}
+	}
+	return Errors{{Field: "body", Message: err.Error()}}
+}
+
+// typeMessage describes the JSON type expected for a Go type
+func typeMessage(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "must be a string"
+	case reflect.Bool:
+		return "must be a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "must be an integer"
+	case reflect.Float32, reflect.Float64:
+		return "must be a number"
+	case reflect.Slice, reflect.Array:
+		return "must be an array"
+	case reflect.Struct, reflect.Map:
+		return "must be an object"
+	}
+	return "has an invalid type"
+}